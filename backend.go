@@ -0,0 +1,72 @@
+package youdb
+
+import "fmt"
+
+// Backend is the storage engine underneath a DB: a set of named,
+// independently-keyed buckets accessed inside View (read-only) or Update
+// (read-write) transactions. The bolt, leveldb and memory backends in this
+// package all implement it, so Hset/Zset/Zscan and the rest of DB's
+// exported methods compile unchanged against whichever one Open picks.
+type Backend interface {
+	View(fn func(tx BackendTx) error) error
+	Update(fn func(tx BackendTx) error) error
+	Close() error
+}
+
+// BackendTx is a transaction against a Backend.
+type BackendTx interface {
+	// Bucket returns the named bucket, or nil if it does not exist.
+	Bucket(name []byte) BackendBucket
+	// CreateBucketIfNotExists returns the named bucket, creating it first
+	// if needed. It is only valid inside Update.
+	CreateBucketIfNotExists(name []byte) (BackendBucket, error)
+	// DeleteBucket removes a bucket and everything in it. It is only valid
+	// inside Update.
+	DeleteBucket(name []byte) error
+	// ForEach calls fn for every top-level bucket.
+	ForEach(fn func(name []byte, b BackendBucket) error) error
+}
+
+// BackendBucket is one named key space within a BackendTx.
+type BackendBucket interface {
+	Get(key []byte) []byte
+	Put(key, value []byte) error
+	Delete(key []byte) error
+	Cursor() BackendCursor
+}
+
+// BackendCursor iterates a BackendBucket's keys in sorted order.
+type BackendCursor interface {
+	Seek(seek []byte) (key, value []byte)
+	Next() (key, value []byte)
+	Prev() (key, value []byte)
+	Last() (key, value []byte)
+}
+
+// Option configures Open.
+type Option func(*openConfig)
+
+type openConfig struct {
+	backend string
+}
+
+// WithBackend selects the storage engine Open uses: "bolt" (the default),
+// "leveldb", or "memory".
+func WithBackend(name string) Option {
+	return func(c *openConfig) {
+		c.backend = name
+	}
+}
+
+func newBackend(name, path string) (Backend, error) {
+	switch name {
+	case "", "bolt":
+		return openBoltBackend(path)
+	case "leveldb":
+		return openLeveldbBackend(path)
+	case "memory":
+		return openMemoryBackend(), nil
+	default:
+		return nil, fmt.Errorf("youdb: unknown backend %q", name)
+	}
+}
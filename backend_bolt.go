@@ -0,0 +1,85 @@
+package youdb
+
+import (
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+// boltBackend is the default Backend, storing everything in a single
+// bolt.DB file, same as youdb always has.
+type boltBackend struct {
+	db *bolt.DB
+}
+
+func openBoltBackend(path string) (Backend, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 1 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+	return &boltBackend{db: db}, nil
+}
+
+func (be *boltBackend) View(fn func(tx BackendTx) error) error {
+	return be.db.View(func(tx *bolt.Tx) error {
+		return fn(boltTx{tx})
+	})
+}
+
+func (be *boltBackend) Update(fn func(tx BackendTx) error) error {
+	return be.db.Update(func(tx *bolt.Tx) error {
+		return fn(boltTx{tx})
+	})
+}
+
+func (be *boltBackend) Close() error {
+	return be.db.Close()
+}
+
+type boltTx struct {
+	tx *bolt.Tx
+}
+
+func (t boltTx) Bucket(name []byte) BackendBucket {
+	b := t.tx.Bucket(name)
+	if b == nil {
+		return nil
+	}
+	return boltBucket{b}
+}
+
+func (t boltTx) CreateBucketIfNotExists(name []byte) (BackendBucket, error) {
+	b, err := t.tx.CreateBucketIfNotExists(name)
+	if err != nil {
+		return nil, err
+	}
+	return boltBucket{b}, nil
+}
+
+func (t boltTx) DeleteBucket(name []byte) error {
+	return t.tx.DeleteBucket(name)
+}
+
+func (t boltTx) ForEach(fn func(name []byte, b BackendBucket) error) error {
+	return t.tx.ForEach(func(name []byte, b *bolt.Bucket) error {
+		return fn(name, boltBucket{b})
+	})
+}
+
+type boltBucket struct {
+	b *bolt.Bucket
+}
+
+func (b boltBucket) Get(key []byte) []byte       { return b.b.Get(key) }
+func (b boltBucket) Put(key, value []byte) error { return b.b.Put(key, value) }
+func (b boltBucket) Delete(key []byte) error     { return b.b.Delete(key) }
+func (b boltBucket) Cursor() BackendCursor       { return boltCursor{b.b.Cursor()} }
+
+type boltCursor struct {
+	c *bolt.Cursor
+}
+
+func (c boltCursor) Seek(seek []byte) ([]byte, []byte) { return c.c.Seek(seek) }
+func (c boltCursor) Next() ([]byte, []byte)            { return c.c.Next() }
+func (c boltCursor) Prev() ([]byte, []byte)            { return c.c.Prev() }
+func (c boltCursor) Last() ([]byte, []byte)            { return c.c.Last() }
@@ -0,0 +1,216 @@
+package youdb
+
+import (
+	"errors"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/iterator"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// leveldbBackend stores buckets as a single flat keyspace, each key
+// prefixed with its bucket name and a NUL separator, to get LevelDB's
+// compaction characteristics for write-heavy zset workloads.
+type leveldbBackend struct {
+	db *leveldb.DB
+}
+
+func openLeveldbBackend(path string) (Backend, error) {
+	db, err := leveldb.OpenFile(path, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &leveldbBackend{db: db}, nil
+}
+
+func (be *leveldbBackend) View(fn func(tx BackendTx) error) error {
+	snap, err := be.db.GetSnapshot()
+	if err != nil {
+		return err
+	}
+	defer snap.Release()
+	return fn(&leveldbTx{reader: snap})
+}
+
+func (be *leveldbBackend) Update(fn func(tx BackendTx) error) error {
+	ltx, err := be.db.OpenTransaction()
+	if err != nil {
+		return err
+	}
+	if err := fn(&leveldbTx{reader: ltx, writer: ltx}); err != nil {
+		ltx.Discard()
+		return err
+	}
+	return ltx.Commit()
+}
+
+func (be *leveldbBackend) Close() error {
+	return be.db.Close()
+}
+
+// leveldbReader is implemented by *leveldb.DB, *leveldb.Snapshot and
+// *leveldb.Transaction.
+type leveldbReader interface {
+	Get(key []byte, ro *opt.ReadOptions) ([]byte, error)
+	NewIterator(slice *util.Range, ro *opt.ReadOptions) iterator.Iterator
+}
+
+// leveldbWriter is implemented by *leveldb.DB and *leveldb.Transaction.
+type leveldbWriter interface {
+	Put(key, value []byte, wo *opt.WriteOptions) error
+	Delete(key []byte, wo *opt.WriteOptions) error
+}
+
+type leveldbTx struct {
+	reader leveldbReader
+	writer leveldbWriter // nil inside View
+}
+
+// Data and bucket-marker keys live in disjoint namespaces (dataNS vs
+// metaNS prefix bytes) so a bucket that exists but holds no data keys
+// (e.g. every entry was deleted) is still distinguishable from a bucket
+// that was never created: Bucket() checks the marker, not whether a
+// prefix scan happens to find a data key.
+const (
+	metaNS = 0
+	dataNS = 1
+)
+
+func bucketPrefix(name []byte) []byte {
+	p := make([]byte, 0, len(name)+2)
+	p = append(p, dataNS)
+	p = append(p, name...)
+	return append(p, 0)
+}
+
+func bucketMarker(name []byte) []byte {
+	p := make([]byte, 0, len(name)+1)
+	p = append(p, metaNS)
+	return append(p, name...)
+}
+
+func (t *leveldbTx) Bucket(name []byte) BackendBucket {
+	if _, err := t.reader.Get(bucketMarker(name), nil); err != nil {
+		return nil
+	}
+	return &leveldbBucket{tx: t, prefix: bucketPrefix(name)}
+}
+
+func (t *leveldbTx) CreateBucketIfNotExists(name []byte) (BackendBucket, error) {
+	if t.writer == nil {
+		return nil, errors.New("youdb: leveldb read-only transaction")
+	}
+	if _, err := t.reader.Get(bucketMarker(name), nil); err != nil {
+		if err := t.writer.Put(bucketMarker(name), []byte{}, nil); err != nil {
+			return nil, err
+		}
+	}
+	return &leveldbBucket{tx: t, prefix: bucketPrefix(name)}, nil
+}
+
+func (t *leveldbTx) DeleteBucket(name []byte) error {
+	if t.writer == nil {
+		return errors.New("youdb: leveldb read-only transaction")
+	}
+	prefix := bucketPrefix(name)
+	it := t.reader.NewIterator(util.BytesPrefix(prefix), nil)
+	defer it.Release()
+	for it.Next() {
+		if err := t.writer.Delete(append([]byte{}, it.Key()...), nil); err != nil {
+			return err
+		}
+	}
+	if err := it.Error(); err != nil {
+		return err
+	}
+	return t.writer.Delete(bucketMarker(name), nil)
+}
+
+func (t *leveldbTx) ForEach(fn func(name []byte, b BackendBucket) error) error {
+	it := t.reader.NewIterator(util.BytesPrefix([]byte{metaNS}), nil)
+	defer it.Release()
+	for it.Next() {
+		name := append([]byte{}, it.Key()[1:]...)
+		if err := fn(name, &leveldbBucket{tx: t, prefix: bucketPrefix(name)}); err != nil {
+			return err
+		}
+	}
+	return it.Error()
+}
+
+type leveldbBucket struct {
+	tx     *leveldbTx
+	prefix []byte
+}
+
+func (b *leveldbBucket) Get(key []byte) []byte {
+	v, err := b.tx.reader.Get(append(append([]byte{}, b.prefix...), key...), nil)
+	if err != nil {
+		return nil
+	}
+	return v
+}
+
+func (b *leveldbBucket) Put(key, value []byte) error {
+	if b.tx.writer == nil {
+		return errors.New("youdb: leveldb read-only transaction")
+	}
+	return b.tx.writer.Put(append(append([]byte{}, b.prefix...), key...), value, nil)
+}
+
+func (b *leveldbBucket) Delete(key []byte) error {
+	if b.tx.writer == nil {
+		return errors.New("youdb: leveldb read-only transaction")
+	}
+	return b.tx.writer.Delete(append(append([]byte{}, b.prefix...), key...), nil)
+}
+
+func (b *leveldbBucket) Cursor() BackendCursor {
+	it := b.tx.reader.NewIterator(util.BytesPrefix(b.prefix), nil)
+	return &leveldbCursor{it: it, prefix: b.prefix}
+}
+
+type leveldbCursor struct {
+	it     iterator.Iterator
+	prefix []byte
+}
+
+func (c *leveldbCursor) strip(k []byte) []byte {
+	if k == nil {
+		return nil
+	}
+	return append([]byte{}, k[len(c.prefix):]...)
+}
+
+func (c *leveldbCursor) value() []byte {
+	return append([]byte{}, c.it.Value()...)
+}
+
+func (c *leveldbCursor) Seek(seek []byte) ([]byte, []byte) {
+	if !c.it.Seek(append(append([]byte{}, c.prefix...), seek...)) {
+		return nil, nil
+	}
+	return c.strip(c.it.Key()), c.value()
+}
+
+func (c *leveldbCursor) Next() ([]byte, []byte) {
+	if !c.it.Next() {
+		return nil, nil
+	}
+	return c.strip(c.it.Key()), c.value()
+}
+
+func (c *leveldbCursor) Prev() ([]byte, []byte) {
+	if !c.it.Prev() {
+		return nil, nil
+	}
+	return c.strip(c.it.Key()), c.value()
+}
+
+func (c *leveldbCursor) Last() ([]byte, []byte) {
+	if !c.it.Last() {
+		return nil, nil
+	}
+	return c.strip(c.it.Key()), c.value()
+}
@@ -0,0 +1,239 @@
+package youdb
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+	"sync"
+)
+
+const skiplistMaxLevel = 16
+
+// skiplistNode is one key/value pair in a skiplist, forward is its
+// per-level successor list.
+type skiplistNode struct {
+	key, val []byte
+	forward  []*skiplistNode
+}
+
+// skiplist is an ordered, concurrency-safe key/value structure backing one
+// memory-backend bucket: sync.Map gets us the bucket-name -> bucket lookup,
+// this gets us Cursor's sorted iteration within a bucket.
+type skiplist struct {
+	mu    sync.RWMutex
+	head  *skiplistNode
+	level int
+}
+
+func newSkiplist() *skiplist {
+	return &skiplist{head: &skiplistNode{forward: make([]*skiplistNode, skiplistMaxLevel)}, level: 1}
+}
+
+func randomLevel() int {
+	lvl := 1
+	for lvl < skiplistMaxLevel && rand.Int31()&1 == 1 {
+		lvl++
+	}
+	return lvl
+}
+
+func (s *skiplist) get(key []byte) []byte {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	x := s.head
+	for i := s.level - 1; i >= 0; i-- {
+		for x.forward[i] != nil && bytes.Compare(x.forward[i].key, key) < 0 {
+			x = x.forward[i]
+		}
+	}
+	x = x.forward[0]
+	if x != nil && bytes.Equal(x.key, key) {
+		return x.val
+	}
+	return nil
+}
+
+func (s *skiplist) put(key, val []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	update := make([]*skiplistNode, skiplistMaxLevel)
+	x := s.head
+	for i := s.level - 1; i >= 0; i-- {
+		for x.forward[i] != nil && bytes.Compare(x.forward[i].key, key) < 0 {
+			x = x.forward[i]
+		}
+		update[i] = x
+	}
+	x = x.forward[0]
+	if x != nil && bytes.Equal(x.key, key) {
+		x.val = append([]byte{}, val...)
+		return
+	}
+
+	lvl := randomLevel()
+	if lvl > s.level {
+		for i := s.level; i < lvl; i++ {
+			update[i] = s.head
+		}
+		s.level = lvl
+	}
+	node := &skiplistNode{
+		key:     append([]byte{}, key...),
+		val:     append([]byte{}, val...),
+		forward: make([]*skiplistNode, lvl),
+	}
+	for i := 0; i < lvl; i++ {
+		node.forward[i] = update[i].forward[i]
+		update[i].forward[i] = node
+	}
+}
+
+func (s *skiplist) delete(key []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	update := make([]*skiplistNode, skiplistMaxLevel)
+	x := s.head
+	for i := s.level - 1; i >= 0; i-- {
+		for x.forward[i] != nil && bytes.Compare(x.forward[i].key, key) < 0 {
+			x = x.forward[i]
+		}
+		update[i] = x
+	}
+	x = x.forward[0]
+	if x == nil || !bytes.Equal(x.key, key) {
+		return
+	}
+	for i := 0; i < s.level; i++ {
+		if update[i].forward[i] == x {
+			update[i].forward[i] = x.forward[i]
+		}
+	}
+}
+
+// ordered returns every node in ascending key order. The memory backend is
+// meant for tests, so Cursor snapshots the whole list rather than keeping
+// the backward links a real skiplist cursor would need for Prev.
+func (s *skiplist) ordered() []*skiplistNode {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var nodes []*skiplistNode
+	for x := s.head.forward[0]; x != nil; x = x.forward[0] {
+		nodes = append(nodes, x)
+	}
+	return nodes
+}
+
+// memoryBackend is a pure in-memory Backend with no persistence, for tests.
+type memoryBackend struct {
+	buckets sync.Map // string -> *skiplist
+}
+
+func openMemoryBackend() Backend {
+	return &memoryBackend{}
+}
+
+func (be *memoryBackend) View(fn func(tx BackendTx) error) error {
+	return fn(&memoryTx{backend: be, writable: false})
+}
+
+func (be *memoryBackend) Update(fn func(tx BackendTx) error) error {
+	return fn(&memoryTx{backend: be, writable: true})
+}
+
+func (be *memoryBackend) Close() error { return nil }
+
+type memoryTx struct {
+	backend  *memoryBackend
+	writable bool
+}
+
+func (t *memoryTx) Bucket(name []byte) BackendBucket {
+	v, ok := t.backend.buckets.Load(string(name))
+	if !ok {
+		return nil
+	}
+	return &memoryBucket{list: v.(*skiplist)}
+}
+
+func (t *memoryTx) CreateBucketIfNotExists(name []byte) (BackendBucket, error) {
+	if !t.writable {
+		return nil, errors.New("youdb: memory read-only transaction")
+	}
+	v, _ := t.backend.buckets.LoadOrStore(string(name), newSkiplist())
+	return &memoryBucket{list: v.(*skiplist)}, nil
+}
+
+func (t *memoryTx) DeleteBucket(name []byte) error {
+	if !t.writable {
+		return errors.New("youdb: memory read-only transaction")
+	}
+	t.backend.buckets.Delete(string(name))
+	return nil
+}
+
+func (t *memoryTx) ForEach(fn func(name []byte, b BackendBucket) error) error {
+	var rangeErr error
+	t.backend.buckets.Range(func(k, v interface{}) bool {
+		rangeErr = fn([]byte(k.(string)), &memoryBucket{list: v.(*skiplist)})
+		return rangeErr == nil
+	})
+	return rangeErr
+}
+
+type memoryBucket struct {
+	list *skiplist
+}
+
+func (b *memoryBucket) Get(key []byte) []byte       { return b.list.get(key) }
+func (b *memoryBucket) Put(key, value []byte) error { b.list.put(key, value); return nil }
+func (b *memoryBucket) Delete(key []byte) error     { b.list.delete(key); return nil }
+func (b *memoryBucket) Cursor() BackendCursor       { return &memoryCursor{list: b.list} }
+
+// memoryCursor snapshots its bucket's entries, in order, on the first
+// Seek/Last call, then walks that snapshot like bolt's cursor walks its
+// own point-in-time view of a bucket.
+type memoryCursor struct {
+	list  *skiplist
+	nodes []*skiplistNode
+	pos   int
+}
+
+func (c *memoryCursor) Seek(seek []byte) ([]byte, []byte) {
+	c.nodes = c.list.ordered()
+	for i, n := range c.nodes {
+		if bytes.Compare(n.key, seek) >= 0 {
+			c.pos = i
+			return n.key, n.val
+		}
+	}
+	c.pos = len(c.nodes)
+	return nil, nil
+}
+
+func (c *memoryCursor) Next() ([]byte, []byte) {
+	c.pos++
+	if c.pos < 0 || c.pos >= len(c.nodes) {
+		return nil, nil
+	}
+	n := c.nodes[c.pos]
+	return n.key, n.val
+}
+
+func (c *memoryCursor) Prev() ([]byte, []byte) {
+	c.pos--
+	if c.pos < 0 || c.pos >= len(c.nodes) {
+		return nil, nil
+	}
+	n := c.nodes[c.pos]
+	return n.key, n.val
+}
+
+func (c *memoryCursor) Last() ([]byte, []byte) {
+	c.nodes = c.list.ordered()
+	c.pos = len(c.nodes) - 1
+	if c.pos < 0 {
+		return nil, nil
+	}
+	n := c.nodes[c.pos]
+	return n.key, n.val
+}
@@ -0,0 +1,193 @@
+package youdb
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+// backendCase names one Backend to run the shared suite below against.
+type backendCase struct {
+	name string
+	open func(t *testing.T) Backend
+}
+
+var backendCases = []backendCase{
+	{name: "bolt", open: func(t *testing.T) Backend {
+		be, err := openBoltBackend(filepath.Join(t.TempDir(), "test.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return be
+	}},
+	{name: "leveldb", open: func(t *testing.T) Backend {
+		be, err := openLeveldbBackend(filepath.Join(t.TempDir(), "test.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return be
+	}},
+	{name: "memory", open: func(t *testing.T) Backend {
+		return openMemoryBackend()
+	}},
+}
+
+// TestBackendBucketExistsAfterAllKeysDeleted guards against the divergence
+// that let Hget/Zget report bucket_not_found under leveldb where bolt
+// reported key_not_found: once a bucket has been created, deleting every
+// key in it must not make Bucket() start returning nil again.
+func TestBackendBucketExistsAfterAllKeysDeleted(t *testing.T) {
+	for _, bc := range backendCases {
+		bc := bc
+		t.Run(bc.name, func(t *testing.T) {
+			be := bc.open(t)
+			defer be.Close()
+
+			name := []byte("bucket")
+			if err := be.Update(func(tx BackendTx) error {
+				b, err := tx.CreateBucketIfNotExists(name)
+				if err != nil {
+					return err
+				}
+				return b.Put([]byte("k"), []byte("v"))
+			}); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := be.Update(func(tx BackendTx) error {
+				b := tx.Bucket(name)
+				if b == nil {
+					t.Fatal("expected bucket to exist right after creation")
+				}
+				return b.Delete([]byte("k"))
+			}); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := be.View(func(tx BackendTx) error {
+				b := tx.Bucket(name)
+				if b == nil {
+					t.Fatal("expected bucket to still exist once emptied, got nil")
+				}
+				if v := b.Get([]byte("k")); v != nil {
+					t.Fatalf("expected deleted key to be gone, got %q", v)
+				}
+				return nil
+			}); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+// TestBackendBucketNotFoundBeforeCreation guards the other direction: a
+// bucket that was never created must still report as absent.
+func TestBackendBucketNotFoundBeforeCreation(t *testing.T) {
+	for _, bc := range backendCases {
+		bc := bc
+		t.Run(bc.name, func(t *testing.T) {
+			be := bc.open(t)
+			defer be.Close()
+
+			if err := be.View(func(tx BackendTx) error {
+				if b := tx.Bucket([]byte("never-created")); b != nil {
+					t.Fatal("expected nil bucket for a name that was never created")
+				}
+				return nil
+			}); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+// TestBackendDeleteBucketThenRecreate guards against a stale existence
+// marker or leftover data surviving a DeleteBucket/CreateBucketIfNotExists
+// round trip.
+func TestBackendDeleteBucketThenRecreate(t *testing.T) {
+	for _, bc := range backendCases {
+		bc := bc
+		t.Run(bc.name, func(t *testing.T) {
+			be := bc.open(t)
+			defer be.Close()
+
+			name := []byte("bucket")
+			if err := be.Update(func(tx BackendTx) error {
+				b, err := tx.CreateBucketIfNotExists(name)
+				if err != nil {
+					return err
+				}
+				return b.Put([]byte("k"), []byte("v"))
+			}); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := be.Update(func(tx BackendTx) error {
+				return tx.DeleteBucket(name)
+			}); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := be.View(func(tx BackendTx) error {
+				if b := tx.Bucket(name); b != nil {
+					t.Fatal("expected bucket to be gone right after DeleteBucket")
+				}
+				return nil
+			}); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := be.Update(func(tx BackendTx) error {
+				b, err := tx.CreateBucketIfNotExists(name)
+				if err != nil {
+					return err
+				}
+				if v := b.Get([]byte("k")); v != nil {
+					t.Fatalf("expected no leftover value after delete+recreate, got %q", v)
+				}
+				return nil
+			}); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+// TestBackendForEachSeesEmptyBucket guards ForEach against the same
+// existence-vs-data confusion: a bucket with no keys left must still be
+// visited.
+func TestBackendForEachSeesEmptyBucket(t *testing.T) {
+	for _, bc := range backendCases {
+		bc := bc
+		t.Run(bc.name, func(t *testing.T) {
+			be := bc.open(t)
+			defer be.Close()
+
+			name := []byte("bucket")
+			if err := be.Update(func(tx BackendTx) error {
+				b, err := tx.CreateBucketIfNotExists(name)
+				if err != nil {
+					return err
+				}
+				if err := b.Put([]byte("k"), []byte("v")); err != nil {
+					return err
+				}
+				return b.Delete([]byte("k"))
+			}); err != nil {
+				t.Fatal(err)
+			}
+
+			var seen int
+			if err := be.View(func(tx BackendTx) error {
+				return tx.ForEach(func(n []byte, b BackendBucket) error {
+					seen++
+					return nil
+				})
+			}); err != nil {
+				t.Fatal(err)
+			}
+			if seen != 1 {
+				t.Fatalf("expected ForEach to visit the emptied bucket once, got %d", seen)
+			}
+		})
+	}
+}
@@ -0,0 +1,293 @@
+package youdb
+
+import (
+	"bytes"
+	"errors"
+)
+
+// Tx is a handle passed to Batch for running several hash/zset mutations
+// inside one write transaction: on the bolt and leveldb backends a run of
+// tx.Hset/tx.Zincr/etc. either all take effect or none do. Its reads (Hget/Zget) see Batch's own writes as
+// they happen, which is what lets fn move a value from one hashmap into a
+// zset without reading it outside the transaction first. WAL records for
+// everything fn does are only appended once fn returns nil and the
+// transaction actually commits, so a Batch that fails partway never leaves
+// behind WAL records for writes that got rolled back.
+type Tx struct {
+	db      *DB
+	tx      BackendTx
+	pending []Op
+}
+
+// Batch runs fn once inside a single write transaction against db's
+// Backend, so fn can move a value from a hashmap into a zset, or touch
+// several keys, without the unsafe read-modify-write races that calling
+// DB's own methods one at a time would risk. If fn returns an error, none
+// of its writes are kept, and nothing is appended to the WAL. The memory
+// backend is the exception to the first half: its Update applies writes
+// as they happen and does not roll them back, so there writes fn made
+// before returning an error are kept (still with nothing in the WAL).
+func (db *DB) Batch(fn func(tx *Tx) error) error {
+	t := &Tx{db: db}
+	if err := db.Update(func(btx BackendTx) error {
+		t.tx = btx
+		return fn(t)
+	}); err != nil {
+		return err
+	}
+	for _, op := range t.pending {
+		if err := db.walAppend(op); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Hget is Tx's version of DB.Hget: it reads key's current value in name's
+// hashmap as of Batch's own in-progress writes, reporting false if it is
+// unset.
+func (t *Tx) Hget(name string, key []byte) ([]byte, bool) {
+	b := t.tx.Bucket(Bconcat([][]byte{hashPrefix, S2b(name)}))
+	if b == nil {
+		return nil, false
+	}
+	v := b.Get(key)
+	return v, v != nil
+}
+
+// Hset is Tx's version of DB.Hset.
+func (t *Tx) Hset(name string, key, val []byte) error {
+	b, err := t.tx.CreateBucketIfNotExists(Bconcat([][]byte{hashPrefix, S2b(name)}))
+	if err != nil {
+		return err
+	}
+	if err := b.Put(key, val); err != nil {
+		return err
+	}
+	t.pending = append(t.pending, Op{Opcode: OpHset, Bucket: walBucketHash, Name: name, Key: key, Value: val})
+	return nil
+}
+
+// Hmset is Tx's version of DB.Hmset.
+func (t *Tx) Hmset(name string, kvs ...[]byte) error {
+	if len(kvs) == 0 || len(kvs)%2 != 0 {
+		return errors.New("kvs len must is an even number")
+	}
+	b, err := t.tx.CreateBucketIfNotExists(Bconcat([][]byte{hashPrefix, S2b(name)}))
+	if err != nil {
+		return err
+	}
+	for i := 0; i < (len(kvs) - 1); i += 2 {
+		if err := b.Put(kvs[i], kvs[i+1]); err != nil {
+			return err
+		}
+	}
+	for i := 0; i < (len(kvs) - 1); i += 2 {
+		t.pending = append(t.pending, Op{Opcode: OpHmset, Bucket: walBucketHash, Name: name, Key: kvs[i], Value: kvs[i+1]})
+	}
+	return nil
+}
+
+// Hincr is Tx's version of DB.Hincr.
+func (t *Tx) Hincr(name string, key []byte, step uint64) (uint64, error) {
+	b, err := t.tx.CreateBucketIfNotExists(Bconcat([][]byte{hashPrefix, S2b(name)}))
+	if err != nil {
+		return 0, err
+	}
+	var oldNum uint64
+	if v := b.Get(key); v != nil {
+		oldNum = B2i(v)
+	}
+	if step > 0 {
+		if (scoreMax - step) < oldNum {
+			return 0, errors.New("overflow number")
+		}
+	} else {
+		if (oldNum + step) < scoreMin {
+			return 0, errors.New("overflow number")
+		}
+	}
+	oldNum += step
+	if err := b.Put(key, I2b(oldNum)); err != nil {
+		return 0, err
+	}
+	t.pending = append(t.pending, Op{Opcode: OpHincr, Bucket: walBucketHash, Name: name, Key: key, Value: I2b(step)})
+	return oldNum, nil
+}
+
+// Hdel is Tx's version of DB.Hdel.
+func (t *Tx) Hdel(name string, key []byte) error {
+	if b := t.tx.Bucket(Bconcat([][]byte{hashPrefix, S2b(name)})); b != nil {
+		if err := b.Delete(key); err != nil {
+			return err
+		}
+	}
+	if err := clearExpireTx(t.tx, walBucketHash, name, key); err != nil {
+		return err
+	}
+	t.pending = append(t.pending, Op{Opcode: OpHdel, Bucket: walBucketHash, Name: name, Key: key})
+	return nil
+}
+
+// HdelBucket is Tx's version of DB.HdelBucket.
+func (t *Tx) HdelBucket(name string) error {
+	if err := t.tx.DeleteBucket(Bconcat([][]byte{hashPrefix, S2b(name)})); err != nil {
+		return err
+	}
+	t.pending = append(t.pending, Op{Opcode: OpHdelBucket, Bucket: walBucketHash, Name: name})
+	return nil
+}
+
+// Zget is Tx's version of DB.Zget: it reads key's current score in name's
+// zset as of Batch's own in-progress writes, reporting false if it is unset.
+func (t *Tx) Zget(name string, key []byte) (uint64, bool) {
+	b := t.tx.Bucket(Bconcat([][]byte{zetScorePrefix, S2b(name)}))
+	if b == nil {
+		return 0, false
+	}
+	v := b.Get(key)
+	if v == nil {
+		return 0, false
+	}
+	return B2i(v), true
+}
+
+// Zset is Tx's version of DB.Zset.
+func (t *Tx) Zset(name string, key []byte, val uint64) error {
+	score := I2b(val)
+	b1, err := t.tx.CreateBucketIfNotExists(Bconcat([][]byte{zetKeyPrefix, S2b(name)}))
+	if err != nil {
+		return err
+	}
+	b2, err := t.tx.CreateBucketIfNotExists(Bconcat([][]byte{zetScorePrefix, S2b(name)}))
+	if err != nil {
+		return err
+	}
+	oldScore := b2.Get(key)
+	if !bytes.Equal(oldScore, score) {
+		if err := b1.Put(Bconcat([][]byte{score, key}), []byte{}); err != nil {
+			return err
+		}
+		if err := b2.Put(key, score); err != nil {
+			return err
+		}
+		if oldScore != nil {
+			if err := b1.Delete(Bconcat([][]byte{oldScore, key})); err != nil {
+				return err
+			}
+		}
+	}
+	t.pending = append(t.pending, Op{Opcode: OpZset, Bucket: walBucketZset, Name: name, Key: key, Value: score})
+	return nil
+}
+
+// Zmset is Tx's version of DB.Zmset.
+func (t *Tx) Zmset(name string, kvs ...[]byte) error {
+	if len(kvs) == 0 || len(kvs)%2 != 0 {
+		return errors.New("kvs len must is an even number")
+	}
+	b1, err := t.tx.CreateBucketIfNotExists(Bconcat([][]byte{zetKeyPrefix, S2b(name)}))
+	if err != nil {
+		return err
+	}
+	b2, err := t.tx.CreateBucketIfNotExists(Bconcat([][]byte{zetScorePrefix, S2b(name)}))
+	if err != nil {
+		return err
+	}
+	for i := 0; i < (len(kvs) - 1); i += 2 {
+		key, score := kvs[i], kvs[i+1]
+		oldScore := b2.Get(key)
+		if bytes.Equal(oldScore, score) {
+			continue
+		}
+		if err := b1.Put(Bconcat([][]byte{score, key}), []byte{}); err != nil {
+			return err
+		}
+		if err := b2.Put(key, score); err != nil {
+			return err
+		}
+		if oldScore != nil {
+			if err := b1.Delete(Bconcat([][]byte{oldScore, key})); err != nil {
+				return err
+			}
+		}
+	}
+	for i := 0; i < (len(kvs) - 1); i += 2 {
+		t.pending = append(t.pending, Op{Opcode: OpZmset, Bucket: walBucketZset, Name: name, Key: kvs[i], Value: kvs[i+1]})
+	}
+	return nil
+}
+
+// Zincr is Tx's version of DB.Zincr.
+func (t *Tx) Zincr(name string, key []byte, step uint64) (uint64, error) {
+	b1, err := t.tx.CreateBucketIfNotExists(Bconcat([][]byte{zetKeyPrefix, S2b(name)}))
+	if err != nil {
+		return 0, err
+	}
+	b2, err := t.tx.CreateBucketIfNotExists(Bconcat([][]byte{zetScorePrefix, S2b(name)}))
+	if err != nil {
+		return 0, err
+	}
+	var score uint64
+	vOld := b2.Get(key)
+	if vOld != nil {
+		score = B2i(vOld)
+	}
+	if step > 0 {
+		if (scoreMax - step) < score {
+			return 0, errors.New("overflow number")
+		}
+	} else {
+		if (score + step) < scoreMin {
+			return 0, errors.New("overflow number")
+		}
+	}
+	score += step
+	newScoreB := I2b(score)
+	if err := b1.Put(Bconcat([][]byte{newScoreB, key}), []byte{}); err != nil {
+		return 0, err
+	}
+	if err := b2.Put(key, newScoreB); err != nil {
+		return 0, err
+	}
+	if vOld != nil {
+		if err := b1.Delete(Bconcat([][]byte{vOld, key})); err != nil {
+			return 0, err
+		}
+	}
+	t.pending = append(t.pending, Op{Opcode: OpZincr, Bucket: walBucketZset, Name: name, Key: key, Value: I2b(step)})
+	return score, nil
+}
+
+// Zdel is Tx's version of DB.Zdel.
+func (t *Tx) Zdel(name string, key []byte) error {
+	b1 := t.tx.Bucket(Bconcat([][]byte{zetKeyPrefix, S2b(name)}))
+	b2 := t.tx.Bucket(Bconcat([][]byte{zetScorePrefix, S2b(name)}))
+	if b1 != nil && b2 != nil {
+		if oldScore := b2.Get(key); oldScore != nil {
+			if err := b1.Delete(Bconcat([][]byte{oldScore, key})); err != nil {
+				return err
+			}
+			if err := b2.Delete(key); err != nil {
+				return err
+			}
+		}
+	}
+	if err := clearExpireTx(t.tx, walBucketZset, name, key); err != nil {
+		return err
+	}
+	t.pending = append(t.pending, Op{Opcode: OpZdel, Bucket: walBucketZset, Name: name, Key: key})
+	return nil
+}
+
+// ZdelBucket is Tx's version of DB.ZdelBucket.
+func (t *Tx) ZdelBucket(name string) error {
+	if err := t.tx.DeleteBucket(Bconcat([][]byte{zetKeyPrefix, S2b(name)})); err != nil {
+		return err
+	}
+	if err := t.tx.DeleteBucket(Bconcat([][]byte{zetScorePrefix, S2b(name)})); err != nil {
+		return err
+	}
+	t.pending = append(t.pending, Op{Opcode: OpZdelBucket, Bucket: walBucketZset, Name: name})
+	return nil
+}
@@ -0,0 +1,94 @@
+package youdb
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestBatchAtomicMoveHashToZset(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := db.Hset("pending", []byte("alice"), I2b(42)); err != nil {
+		t.Fatal(err)
+	}
+
+	err = db.Batch(func(tx *Tx) error {
+		v, ok := tx.Hget("pending", []byte("alice"))
+		if !ok {
+			t.Fatal("expected pending hashmap entry to be visible inside Batch")
+		}
+		if err := tx.Hdel("pending", []byte("alice")); err != nil {
+			return err
+		}
+		return tx.Zset("ranked", []byte("alice"), B2i(v))
+	})
+	if err != nil {
+		t.Fatalf("Batch: %v", err)
+	}
+
+	if r := db.Hget("pending", []byte("alice")); r.State == replyOK {
+		t.Fatalf("expected alice to be gone from pending, got state %q", r.State)
+	}
+	if r := db.Zget("ranked", []byte("alice")); r.State != replyOK || r.Uint64() != 42 {
+		t.Fatalf("expected alice to be ranked with score 42, got state %q uint64 %d", r.State, r.Uint64())
+	}
+}
+
+func TestBatchRollbackKeepsNoPartialWrites(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	wantErr := errors.New("boom")
+	err = db.Batch(func(tx *Tx) error {
+		if err := tx.Hset("h", []byte("k"), []byte("v")); err != nil {
+			return err
+		}
+		return wantErr
+	})
+	if err != wantErr {
+		t.Fatalf("Batch: got %v, want %v", err, wantErr)
+	}
+
+	if r := db.Hget("h", []byte("k")); r.State == replyOK {
+		t.Fatal("expected the write before the error to be rolled back")
+	}
+}
+
+func TestBatchRollbackDropsWALRecords(t *testing.T) {
+	dir := t.TempDir()
+	db, err := OpenWithWAL(filepath.Join(dir, "test.db"), WALOptions{Dir: filepath.Join(dir, "wal")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	wantErr := errors.New("boom")
+	err = db.Batch(func(tx *Tx) error {
+		if err := tx.Hset("h", []byte("k"), []byte("v")); err != nil {
+			return err
+		}
+		return wantErr
+	})
+	if err != wantErr {
+		t.Fatalf("Batch: got %v, want %v", err, wantErr)
+	}
+
+	var seen int
+	if err := db.ReplayFrom(0, func(op Op) error {
+		seen++
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if seen != 0 {
+		t.Fatalf("expected no WAL records after a rolled-back Batch, got %d", seen)
+	}
+}
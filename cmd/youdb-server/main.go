@@ -0,0 +1,31 @@
+// Command youdb-server exposes a youdb database over the Redis RESP
+// protocol, so that redis-cli or any Redis client library can talk to it
+// without embedding youdb as a Go library.
+package main
+
+import (
+	"flag"
+	"log"
+
+	"github.com/pythonsite/youdb"
+	"github.com/pythonsite/youdb/server"
+)
+
+func main() {
+	dbPath := flag.String("db", "youdb.db", "path to the bolt data file")
+	addr := flag.String("addr", ":6380", "address to listen on")
+	password := flag.String("password", "", "require AUTH with this password if set")
+	flag.Parse()
+
+	db, err := youdb.Open(*dbPath)
+	if err != nil {
+		log.Fatalf("youdb-server: open %s: %v", *dbPath, err)
+	}
+	defer db.Close()
+
+	s := server.New(db, server.Options{Addr: *addr, Password: *password})
+	log.Printf("youdb-server: listening on %s (db=%s)", *addr, *dbPath)
+	if err := s.ListenAndServe(); err != nil {
+		log.Fatalf("youdb-server: %v", err)
+	}
+}
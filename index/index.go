@@ -0,0 +1,258 @@
+// Package index layers Bleve full-text search on top of a youdb hashmap:
+// every Hset/Hmset/Hdel/HdelBucket against a registered hashmap is mirrored
+// into a Bleve index in the background, so callers can find hashmap keys by
+// a search.Query string instead of only by exact key.
+package index
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/blevesearch/bleve"
+	"github.com/blevesearch/bleve/mapping"
+	"github.com/pythonsite/youdb"
+)
+
+// Extract turns a hashmap entry into the document Bleve should index for it.
+type Extract func(key, val []byte) interface{}
+
+// indexOp is queued for a boundIndex's background goroutine; a nil Val
+// means the key was deleted. generation is the boundIndex's generation at
+// enqueue time, so run can drop ops made stale by a concurrent reset
+// instead of indexing them into the index reset built.
+type indexOp struct {
+	Key        []byte
+	Val        []byte
+	generation uint64
+}
+
+// boundIndex is one Bleve index registered against one hashmap name.
+type boundIndex struct {
+	name    string
+	mapping mapping.IndexMapping
+	extract Extract
+
+	mu         sync.RWMutex
+	bi         bleve.Index
+	generation uint64
+	queue      chan indexOp
+}
+
+func newBoundIndex(name string, m mapping.IndexMapping, extract Extract) (*boundIndex, error) {
+	bi, err := bleve.NewMemOnly(m)
+	if err != nil {
+		return nil, err
+	}
+	bx := &boundIndex{
+		name:    name,
+		mapping: m,
+		extract: extract,
+		bi:      bi,
+		queue:   make(chan indexOp, 1024),
+	}
+	go bx.run()
+	return bx, nil
+}
+
+// enqueue tags op with bx's current generation before queuing it, so a
+// reset racing with run can tell the op was queued against the index that
+// reset just discarded.
+func (bx *boundIndex) enqueue(op indexOp) {
+	bx.mu.RLock()
+	op.generation = bx.generation
+	bx.mu.RUnlock()
+	bx.queue <- op
+}
+
+// run drains the queue so that Hset/Hdel callers are never blocked on a
+// Bleve index update.
+func (bx *boundIndex) run() {
+	for op := range bx.queue {
+		bx.mu.RLock()
+		bi := bx.bi
+		gen := bx.generation
+		bx.mu.RUnlock()
+
+		if op.generation != gen {
+			// Queued before a reset that has since run; applying it now
+			// would resurrect a stale or deleted entry in the new index.
+			continue
+		}
+
+		if op.Val == nil {
+			bi.Delete(string(op.Key))
+			continue
+		}
+		bi.Index(string(op.Key), bx.extract(op.Key, op.Val))
+	}
+}
+
+// reset discards all indexed documents by swapping in a fresh, empty index,
+// and bumps the generation so any op already queued against the old index
+// is dropped by run instead of applied to the new one.
+func (bx *boundIndex) reset() error {
+	bi, err := bleve.NewMemOnly(bx.mapping)
+	if err != nil {
+		return err
+	}
+	bx.mu.Lock()
+	old := bx.bi
+	bx.bi = bi
+	bx.generation++
+	bx.mu.Unlock()
+	return old.Close()
+}
+
+func (bx *boundIndex) search(queryString string, from, size int) (*bleve.SearchResult, error) {
+	req := bleve.NewSearchRequestOptions(bleve.NewQueryStringQuery(queryString), size, from, false)
+	bx.mu.RLock()
+	bi := bx.bi
+	bx.mu.RUnlock()
+	return bi.Search(req)
+}
+
+// DB wraps a *youdb.DB, shadowing the hashmap methods that need to keep
+// registered Bleve indexes in sync.
+type DB struct {
+	*youdb.DB
+
+	mu      sync.RWMutex
+	indexes map[string]*boundIndex
+}
+
+// Wrap attaches indexing to an already-open youdb.DB.
+func Wrap(db *youdb.DB) *DB {
+	return &DB{DB: db, indexes: make(map[string]*boundIndex)}
+}
+
+// RegisterIndex creates a Bleve index for the hashmap name, using mapping
+// for the schema and extract to build the document indexed for each
+// key/value pair. Index updates happen on a background queue so Hset/Hmset
+// callers are not slowed down by Bleve analysis.
+func (db *DB) RegisterIndex(name string, m mapping.IndexMapping, extract Extract) error {
+	bx, err := newBoundIndex(name, m, extract)
+	if err != nil {
+		return err
+	}
+	db.mu.Lock()
+	db.indexes[name] = bx
+	db.mu.Unlock()
+	return nil
+}
+
+func (db *DB) boundIndexFor(name string) (*boundIndex, bool) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	bx, ok := db.indexes[name]
+	return bx, ok
+}
+
+// Hset writes through to the underlying hashmap, then queues name's index
+// (if any) for an update.
+func (db *DB) Hset(name string, key, val []byte) error {
+	if err := db.DB.Hset(name, key, val); err != nil {
+		return err
+	}
+	if bx, ok := db.boundIndexFor(name); ok {
+		bx.enqueue(indexOp{Key: key, Val: val})
+	}
+	return nil
+}
+
+// Hmset writes through to the underlying hashmap, then queues name's index
+// (if any) for an update per key/value pair.
+func (db *DB) Hmset(name string, kvs ...[]byte) error {
+	if err := db.DB.Hmset(name, kvs...); err != nil {
+		return err
+	}
+	bx, ok := db.boundIndexFor(name)
+	if !ok {
+		return nil
+	}
+	for i := 0; i < (len(kvs) - 1); i += 2 {
+		bx.enqueue(indexOp{Key: kvs[i], Val: kvs[i+1]})
+	}
+	return nil
+}
+
+// Hdel writes through to the underlying hashmap, then queues name's index
+// (if any) to drop the key.
+func (db *DB) Hdel(name string, key []byte) error {
+	if err := db.DB.Hdel(name, key); err != nil {
+		return err
+	}
+	if bx, ok := db.boundIndexFor(name); ok {
+		bx.enqueue(indexOp{Key: key, Val: nil})
+	}
+	return nil
+}
+
+// HdelBucket writes through to the underlying hashmap, then clears name's
+// index (if any) rather than queuing one delete per key.
+func (db *DB) HdelBucket(name string) error {
+	if err := db.DB.HdelBucket(name); err != nil {
+		return err
+	}
+	if bx, ok := db.boundIndexFor(name); ok {
+		return bx.reset()
+	}
+	return nil
+}
+
+// Search runs queryString against name's registered index and resolves each
+// hit back to its current hashmap value via Hget, returning key/value pairs
+// as a *youdb.Reply in the same shape Hscan/Hmget use.
+func (db *DB) Search(name, queryString string, from, size int) *youdb.Reply {
+	r := &youdb.Reply{State: "error"}
+
+	bx, ok := db.boundIndexFor(name)
+	if !ok {
+		r.State = fmt.Sprintf("index %q is not registered", name)
+		return r
+	}
+
+	result, err := bx.search(queryString, from, size)
+	if err != nil {
+		r.State = err.Error()
+		return r
+	}
+
+	r.State = "ok"
+	for _, hit := range result.Hits {
+		key := []byte(hit.ID)
+		hget := db.DB.Hget(name, key)
+		if hget.State == "ok" {
+			r.Data = append(r.Data, key, hget.Data[0])
+		}
+	}
+	return r
+}
+
+// Rebuild drops and repopulates name's index by scanning the whole hashmap
+// with Hscan, for recovering after a crash or a mapping change.
+func (db *DB) Rebuild(name string) error {
+	bx, ok := db.boundIndexFor(name)
+	if !ok {
+		return fmt.Errorf("index %q is not registered", name)
+	}
+	if err := bx.reset(); err != nil {
+		return err
+	}
+
+	const batch = 1000
+	keyStart := []byte{}
+	for {
+		r := db.DB.Hscan(name, keyStart, batch)
+		list := r.List()
+		if len(list) == 0 {
+			return nil
+		}
+		for _, e := range list {
+			bx.enqueue(indexOp{Key: e.Key, Val: e.Value})
+		}
+		keyStart = list[len(list)-1].Key
+		if len(list) < batch {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package index
+
+import (
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/blevesearch/bleve"
+	"github.com/pythonsite/youdb"
+)
+
+// TestHsetSearchFindsMatchingHit exercises the feature's actual purpose:
+// an Hset against a registered hashmap becomes findable via Search once
+// the background indexing goroutine has drained it.
+func TestHsetSearchFindsMatchingHit(t *testing.T) {
+	ydb, err := youdb.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ydb.Close()
+	db := Wrap(ydb)
+
+	extract := func(key, val []byte) interface{} {
+		return map[string]interface{}{"body": string(val)}
+	}
+	if err := db.RegisterIndex("docs", bleve.NewIndexMapping(), extract); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.Hset("docs", []byte("k1"), []byte("hello world")); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Hset("docs", []byte("k2"), []byte("goodbye world")); err != nil {
+		t.Fatal(err)
+	}
+
+	var r *youdb.Reply
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		r = db.Search("docs", "body:hello", 0, 10)
+		if r.State == "ok" && len(r.List()) > 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if r.State != "ok" {
+		t.Fatalf("expected search to succeed, got state %q", r.State)
+	}
+	list := r.List()
+	if len(list) != 1 || string(list[0].Key) != "k1" {
+		t.Fatalf("expected exactly k1 to match \"hello\", got %v", list)
+	}
+}
+
+// TestRebuildRepopulatesIndexFromHashmap exercises Rebuild's crash-recovery
+// purpose: it must drop the old index and reindex every existing hashmap
+// entry from scratch, even ones written before the index was registered.
+func TestRebuildRepopulatesIndexFromHashmap(t *testing.T) {
+	ydb, err := youdb.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ydb.Close()
+	db := Wrap(ydb)
+
+	// Write straight through the underlying DB, bypassing the index, to
+	// simulate entries that existed before RegisterIndex ran.
+	if err := ydb.Hset("docs", []byte("k1"), []byte("hello world")); err != nil {
+		t.Fatal(err)
+	}
+
+	extract := func(key, val []byte) interface{} {
+		return map[string]interface{}{"body": string(val)}
+	}
+	if err := db.RegisterIndex("docs", bleve.NewIndexMapping(), extract); err != nil {
+		t.Fatal(err)
+	}
+
+	if r := db.Search("docs", "body:hello", 0, 10); len(r.List()) != 0 {
+		t.Fatalf("expected k1 to be unindexed before Rebuild, got %v", r.List())
+	}
+
+	if err := db.Rebuild("docs"); err != nil {
+		t.Fatal(err)
+	}
+
+	var r *youdb.Reply
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		r = db.Search("docs", "body:hello", 0, 10)
+		if r.State == "ok" && len(r.List()) > 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if r.State != "ok" {
+		t.Fatalf("expected search to succeed, got state %q", r.State)
+	}
+	list := r.List()
+	if len(list) != 1 || string(list[0].Key) != "k1" {
+		t.Fatalf("expected Rebuild to index k1 so it's findable, got %v", list)
+	}
+}
+
+// TestHdelBucketResetDropsStaleQueuedOps exercises the race HdelBucket's
+// reset is meant to close: an Hset queued against the pre-reset index must
+// not be indexed into the index reset just built, even if run hasn't
+// drained it yet when reset happens. It inspects bx's Bleve index directly
+// rather than through DB.Search, since Search also drops stale hits on its
+// own (it resolves each hit back through Hget, and HdelBucket has already
+// wiped the hashmap) which would make the assertion pass regardless of
+// whether reset's generation bump actually did anything.
+func TestHdelBucketResetDropsStaleQueuedOps(t *testing.T) {
+	ydb, err := youdb.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ydb.Close()
+	db := Wrap(ydb)
+
+	started := make(chan struct{})
+	proceed := make(chan struct{})
+	var once sync.Once
+	extract := func(key, val []byte) interface{} {
+		once.Do(func() {
+			close(started)
+			<-proceed
+		})
+		return map[string]interface{}{"body": string(val)}
+	}
+
+	if err := db.RegisterIndex("docs", bleve.NewIndexMapping(), extract); err != nil {
+		t.Fatal(err)
+	}
+	bx, _ := db.boundIndexFor("docs")
+
+	if err := db.Hset("docs", []byte("k1"), []byte("one")); err != nil {
+		t.Fatal(err)
+	}
+	<-started // run is now blocked inside extract, indexing k1 against the pre-reset index.
+
+	if err := db.Hset("docs", []byte("k2"), []byte("two")); err != nil {
+		t.Fatal(err)
+	}
+	// k2 is queued behind k1, tagged with the pre-reset generation.
+
+	if err := db.HdelBucket("docs"); err != nil {
+		t.Fatal(err)
+	}
+	// Generation is bumped and a fresh index swapped in before k2 is drained.
+
+	close(proceed) // let run finish with k1, then move on to (and drop) k2.
+
+	if err := db.Hset("docs", []byte("k3"), []byte("three")); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if doc, _ := bx.bi.Document("k3"); doc != nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if doc, _ := bx.bi.Document("k2"); doc != nil {
+		t.Fatalf("expected k2 (queued before reset) not to be resurrected in the post-reset index, got doc %v", doc)
+	}
+}
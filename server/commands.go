@@ -0,0 +1,345 @@
+package server
+
+import (
+	"strconv"
+
+	"github.com/pythonsite/youdb"
+)
+
+func cmdAuth(s *Server, c *conn, args []string) error {
+	if len(args) != 2 {
+		return writeError(c.w, "wrong number of arguments for 'auth' command")
+	}
+	if s.opts.Password == "" {
+		return writeError(c.w, "Client sent AUTH, but no password is set")
+	}
+	if args[1] != s.opts.Password {
+		return writeError(c.w, "invalid password")
+	}
+	c.authed = true
+	return writeSimpleString(c.w, "OK")
+}
+
+func cmdPing(s *Server, c *conn, args []string) error {
+	if len(args) > 1 {
+		return writeBulk(c.w, []byte(args[1]))
+	}
+	return writeSimpleString(c.w, "PONG")
+}
+
+func cmdHset(s *Server, c *conn, args []string) error {
+	if len(args) != 4 {
+		return writeError(c.w, "wrong number of arguments for 'hset' command")
+	}
+	if err := s.db.Hset(args[1], []byte(args[2]), []byte(args[3])); err != nil {
+		return writeError(c.w, err.Error())
+	}
+	return writeInt(c.w, 1)
+}
+
+func cmdHget(s *Server, c *conn, args []string) error {
+	if len(args) != 3 {
+		return writeError(c.w, "wrong number of arguments for 'hget' command")
+	}
+	r := s.db.Hget(args[1], []byte(args[2]))
+	if r.State != "ok" {
+		return writeBulk(c.w, nil)
+	}
+	return writeBulk(c.w, r.Data[0])
+}
+
+func cmdHmget(s *Server, c *conn, args []string) error {
+	if len(args) < 3 {
+		return writeError(c.w, "wrong number of arguments for 'hmget' command")
+	}
+	keys := make([][]byte, 0, len(args)-2)
+	for _, k := range args[2:] {
+		keys = append(keys, []byte(k))
+	}
+	r := s.db.Hmget(args[1], keys)
+	vals := r.Dict()
+	out := make([][]byte, 0, len(keys))
+	for _, k := range keys {
+		out = append(out, vals[k2s(k)])
+	}
+	return writeBulkArray(c.w, out)
+}
+
+func cmdHscan(s *Server, c *conn, args []string) error {
+	if len(args) != 4 {
+		return writeError(c.w, "wrong number of arguments for 'hscan' command")
+	}
+	limit, err := strconv.Atoi(args[3])
+	if err != nil {
+		return writeError(c.w, "limit is not an integer")
+	}
+	r := s.db.Hscan(args[1], []byte(args[2]), limit)
+	return writeBulkArray(c.w, toBytes(r.List()))
+}
+
+func cmdHdel(s *Server, c *conn, args []string) error {
+	if len(args) != 3 {
+		return writeError(c.w, "wrong number of arguments for 'hdel' command")
+	}
+	if err := s.db.Hdel(args[1], []byte(args[2])); err != nil {
+		return writeError(c.w, err.Error())
+	}
+	return writeInt(c.w, 1)
+}
+
+func cmdZadd(s *Server, c *conn, args []string) error {
+	if len(args) != 4 {
+		return writeError(c.w, "wrong number of arguments for 'zadd' command")
+	}
+	score, err := strconv.ParseUint(args[2], 10, 64)
+	if err != nil {
+		return writeError(c.w, "score is not an unsigned integer")
+	}
+	if err := s.db.Zset(args[1], []byte(args[3]), score); err != nil {
+		return writeError(c.w, err.Error())
+	}
+	return writeInt(c.w, 1)
+}
+
+func cmdZincrby(s *Server, c *conn, args []string) error {
+	if len(args) != 4 {
+		return writeError(c.w, "wrong number of arguments for 'zincrby' command")
+	}
+	step, err := strconv.ParseUint(args[2], 10, 64)
+	if err != nil {
+		return writeError(c.w, "step is not an unsigned integer")
+	}
+	score, err := s.db.Zincr(args[1], []byte(args[3]), step)
+	if err != nil {
+		return writeError(c.w, err.Error())
+	}
+	return writeBulk(c.w, []byte(strconv.FormatUint(score, 10)))
+}
+
+func cmdZrange(s *Server, c *conn, args []string) error {
+	if len(args) != 4 {
+		return writeError(c.w, "wrong number of arguments for 'zrange' command")
+	}
+	limit, err := strconv.Atoi(args[3])
+	if err != nil {
+		return writeError(c.w, "limit is not an integer")
+	}
+	r := s.db.Zscan(args[1], []byte(args[2]), nil, limit)
+	return writeBulkArray(c.w, toBytes(r.List()))
+}
+
+func cmdZrangebyscore(s *Server, c *conn, args []string) error {
+	if len(args) != 4 {
+		return writeError(c.w, "wrong number of arguments for 'zrangebyscore' command")
+	}
+	min, err := strconv.ParseUint(args[2], 10, 64)
+	if err != nil {
+		return writeError(c.w, "min is not an unsigned integer")
+	}
+	max, err := strconv.ParseUint(args[3], 10, 64)
+	if err != nil {
+		return writeError(c.w, "max is not an unsigned integer")
+	}
+	r := s.db.Zrangebyscore(args[1], min, max, 0, 0)
+	if r.State != "ok" {
+		return writeBulkArray(c.w, [][]byte{})
+	}
+	return writeBulkArray(c.w, toBytes(r.List()))
+}
+
+func cmdZscore(s *Server, c *conn, args []string) error {
+	if len(args) != 3 {
+		return writeError(c.w, "wrong number of arguments for 'zscore' command")
+	}
+	r := s.db.Zget(args[1], []byte(args[2]))
+	if r.State != "ok" {
+		return writeBulk(c.w, nil)
+	}
+	return writeBulk(c.w, []byte(strconv.FormatUint(r.Uint64(), 10)))
+}
+
+func cmdDel(s *Server, c *conn, args []string) error {
+	if len(args) != 2 {
+		return writeError(c.w, "wrong number of arguments for 'del' command")
+	}
+	if err := s.db.HdelBucket(args[1]); err != nil {
+		return writeError(c.w, err.Error())
+	}
+	return writeInt(c.w, 1)
+}
+
+func cmdMulti(s *Server, c *conn, args []string) error {
+	c.inMulti = true
+	c.queuedCmds = c.queuedCmds[:0]
+	return writeSimpleString(c.w, "OK")
+}
+
+func cmdDiscard(s *Server, c *conn, args []string) error {
+	c.inMulti = false
+	c.queuedCmds = nil
+	return writeSimpleString(c.w, "OK")
+}
+
+// cmdExec replays the queued commands in order and collects their replies.
+// Commands with a txHandlers entry run inside a single db.Batch, so their
+// writes either all take effect or none do; the rest (plain scans and PING,
+// which Tx has no equivalent for) run directly against s.db as before.
+func cmdExec(s *Server, c *conn, args []string) error {
+	queued := c.queuedCmds
+	c.inMulti = false
+	c.queuedCmds = nil
+
+	if err := writeArray(c.w, len(queued)); err != nil {
+		return err
+	}
+	return s.db.Batch(func(tx *youdb.Tx) error {
+		for _, cmdArgs := range queued {
+			name := upper(cmdArgs[0])
+			if h, ok := txHandlers[name]; ok {
+				if err := h(tx, c, cmdArgs); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := handlers[name](s, c, cmdArgs); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// txHandlerFunc is cmdExec's counterpart to handlerFunc for commands that
+// run inside a db.Batch: it takes the in-progress *youdb.Tx instead of the
+// Server, so its writes are part of the surrounding transaction.
+type txHandlerFunc func(tx *youdb.Tx, c *conn, args []string) error
+
+// txHandlers covers the queueable commands that have a direct Tx
+// equivalent. Commands with no Tx equivalent (HSCAN, ZRANGE,
+// ZRANGEBYSCORE, PING) are absent and fall back to running against s.db
+// outside the batch in cmdExec.
+var txHandlers = map[string]txHandlerFunc{
+	"HSET":    txHset,
+	"HGET":    txHget,
+	"HMGET":   txHmget,
+	"HDEL":    txHdel,
+	"ZADD":    txZadd,
+	"ZINCRBY": txZincrby,
+	"ZSCORE":  txZscore,
+	"DEL":     txDel,
+}
+
+func txHset(tx *youdb.Tx, c *conn, args []string) error {
+	if len(args) != 4 {
+		return writeError(c.w, "wrong number of arguments for 'hset' command")
+	}
+	if err := tx.Hset(args[1], []byte(args[2]), []byte(args[3])); err != nil {
+		return writeError(c.w, err.Error())
+	}
+	return writeInt(c.w, 1)
+}
+
+func txHget(tx *youdb.Tx, c *conn, args []string) error {
+	if len(args) != 3 {
+		return writeError(c.w, "wrong number of arguments for 'hget' command")
+	}
+	v, ok := tx.Hget(args[1], []byte(args[2]))
+	if !ok {
+		return writeBulk(c.w, nil)
+	}
+	return writeBulk(c.w, v)
+}
+
+func txHmget(tx *youdb.Tx, c *conn, args []string) error {
+	if len(args) < 3 {
+		return writeError(c.w, "wrong number of arguments for 'hmget' command")
+	}
+	out := make([][]byte, 0, len(args)-2)
+	for _, k := range args[2:] {
+		v, _ := tx.Hget(args[1], []byte(k))
+		out = append(out, v)
+	}
+	return writeBulkArray(c.w, out)
+}
+
+func txHdel(tx *youdb.Tx, c *conn, args []string) error {
+	if len(args) != 3 {
+		return writeError(c.w, "wrong number of arguments for 'hdel' command")
+	}
+	if err := tx.Hdel(args[1], []byte(args[2])); err != nil {
+		return writeError(c.w, err.Error())
+	}
+	return writeInt(c.w, 1)
+}
+
+func txZadd(tx *youdb.Tx, c *conn, args []string) error {
+	if len(args) != 4 {
+		return writeError(c.w, "wrong number of arguments for 'zadd' command")
+	}
+	score, err := strconv.ParseUint(args[2], 10, 64)
+	if err != nil {
+		return writeError(c.w, "score is not an unsigned integer")
+	}
+	if err := tx.Zset(args[1], []byte(args[3]), score); err != nil {
+		return writeError(c.w, err.Error())
+	}
+	return writeInt(c.w, 1)
+}
+
+func txZincrby(tx *youdb.Tx, c *conn, args []string) error {
+	if len(args) != 4 {
+		return writeError(c.w, "wrong number of arguments for 'zincrby' command")
+	}
+	step, err := strconv.ParseUint(args[2], 10, 64)
+	if err != nil {
+		return writeError(c.w, "step is not an unsigned integer")
+	}
+	score, err := tx.Zincr(args[1], []byte(args[3]), step)
+	if err != nil {
+		return writeError(c.w, err.Error())
+	}
+	return writeBulk(c.w, []byte(strconv.FormatUint(score, 10)))
+}
+
+func txZscore(tx *youdb.Tx, c *conn, args []string) error {
+	if len(args) != 3 {
+		return writeError(c.w, "wrong number of arguments for 'zscore' command")
+	}
+	score, ok := tx.Zget(args[1], []byte(args[2]))
+	if !ok {
+		return writeBulk(c.w, nil)
+	}
+	return writeBulk(c.w, []byte(strconv.FormatUint(score, 10)))
+}
+
+func txDel(tx *youdb.Tx, c *conn, args []string) error {
+	if len(args) != 2 {
+		return writeError(c.w, "wrong number of arguments for 'del' command")
+	}
+	if err := tx.HdelBucket(args[1]); err != nil {
+		return writeError(c.w, err.Error())
+	}
+	return writeInt(c.w, 1)
+}
+
+func upper(s string) string {
+	b := []byte(s)
+	for i, c := range b {
+		if c >= 'a' && c <= 'z' {
+			b[i] = c - ('a' - 'A')
+		}
+	}
+	return string(b)
+}
+
+func k2s(b []byte) string {
+	return string(b)
+}
+
+func toBytes(data []youdb.Entry) [][]byte {
+	out := make([][]byte, 0, len(data)*2)
+	for _, e := range data {
+		out = append(out, e.Key, e.Value)
+	}
+	return out
+}
@@ -0,0 +1,132 @@
+package server
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// errProtocol is returned when the client sends something that does not
+// parse as a RESP request (a bulk-string array).
+var errProtocol = errors.New("server: protocol error")
+
+// maxArrayLen and maxBulkLen cap the array-length and bulk-string-length
+// headers readCommand will believe before it allocates anything: both are
+// attacker-controlled and read off the wire before AUTH, so an unauthenticated
+// "*2000000000\r\n" must fail as a protocol error instead of driving an
+// out-of-memory allocation.
+const (
+	maxArrayLen = 1024
+	maxBulkLen  = 512 * 1024 * 1024
+)
+
+// readCommand reads one RESP-encoded command (an array of bulk strings) off
+// r and returns its arguments, e.g. "*2\r\n$4\r\nHGET\r\n$1\r\na\r\n" -> ["HGET", "a"].
+//
+// redis-cli and the major client libraries always speak the array form for
+// commands, so inline commands are intentionally not supported here.
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 || line[0] != '*' {
+		return nil, errProtocol
+	}
+	n, err := strconv.Atoi(line[1:])
+	if err != nil || n < 0 || n > maxArrayLen {
+		return nil, errProtocol
+	}
+
+	args := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		head, err := readLine(r)
+		if err != nil {
+			return nil, err
+		}
+		if len(head) == 0 || head[0] != '$' {
+			return nil, errProtocol
+		}
+		size, err := strconv.Atoi(head[1:])
+		if err != nil || size < 0 || size > maxBulkLen {
+			return nil, errProtocol
+		}
+		buf := make([]byte, size+2) // payload + trailing CRLF
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		args = append(args, string(buf[:size]))
+	}
+	return args, nil
+}
+
+// readLine reads a single CRLF-terminated line and strips the terminator.
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	if len(line) < 2 || line[len(line)-2] != '\r' {
+		return "", errProtocol
+	}
+	return line[:len(line)-2], nil
+}
+
+// writeSimpleString writes a RESP simple string, e.g. "+OK\r\n".
+func writeSimpleString(w *bufio.Writer, s string) error {
+	_, err := fmt.Fprintf(w, "+%s\r\n", s)
+	return err
+}
+
+// writeError writes a RESP error, e.g. "-ERR bucket_not_found\r\n".
+func writeError(w *bufio.Writer, msg string) error {
+	_, err := fmt.Fprintf(w, "-ERR %s\r\n", msg)
+	return err
+}
+
+// writeInt writes a RESP integer, e.g. ":1\r\n".
+func writeInt(w *bufio.Writer, n int) error {
+	_, err := fmt.Fprintf(w, ":%d\r\n", n)
+	return err
+}
+
+// writeBulk writes a RESP bulk string, or the null bulk string when b is nil.
+func writeBulk(w *bufio.Writer, b []byte) error {
+	if b == nil {
+		_, err := w.WriteString("$-1\r\n")
+		return err
+	}
+	if _, err := fmt.Fprintf(w, "$%d\r\n", len(b)); err != nil {
+		return err
+	}
+	if _, err := w.Write(b); err != nil {
+		return err
+	}
+	_, err := w.WriteString("\r\n")
+	return err
+}
+
+// writeArray writes a RESP array header; the caller writes n elements after.
+func writeArray(w *bufio.Writer, n int) error {
+	_, err := fmt.Fprintf(w, "*%d\r\n", n)
+	return err
+}
+
+// writeBulkArray writes a RESP array of bulk strings in one call.
+func writeBulkArray(w *bufio.Writer, items [][]byte) error {
+	if items == nil {
+		_, err := w.WriteString("*-1\r\n")
+		return err
+	}
+	if err := writeArray(w, len(items)); err != nil {
+		return err
+	}
+	for _, item := range items {
+		if err := writeBulk(w, item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+// Package server exposes a youdb.DB over the Redis RESP protocol, so that
+// redis-cli or any Redis client library can talk to youdb without embedding
+// it as a Go library.
+package server
+
+import (
+	"bufio"
+	"io"
+	"log"
+	"net"
+	"strings"
+
+	"github.com/pythonsite/youdb"
+)
+
+// handlerFunc implements one RESP command against db, writing its reply to w.
+type handlerFunc func(s *Server, conn *conn, args []string) error
+
+// handlers is the command dispatch table, keyed by the upper-cased command
+// name. cmdExec looks commands up in it too, so it is built in init rather
+// than a var initializer: cmdExec's body referencing handlers would
+// otherwise make the initializer expression and cmdExec mutually
+// dependent, which the compiler rejects as an initialization cycle.
+var handlers map[string]handlerFunc
+
+func init() {
+	handlers = map[string]handlerFunc{
+		"AUTH":          cmdAuth,
+		"PING":          cmdPing,
+		"HSET":          cmdHset,
+		"HGET":          cmdHget,
+		"HMGET":         cmdHmget,
+		"HSCAN":         cmdHscan,
+		"HDEL":          cmdHdel,
+		"ZADD":          cmdZadd,
+		"ZINCRBY":       cmdZincrby,
+		"ZRANGE":        cmdZrange,
+		"ZRANGEBYSCORE": cmdZrangebyscore,
+		"ZSCORE":        cmdZscore,
+		"DEL":           cmdDel,
+		"MULTI":         cmdMulti,
+		"EXEC":          cmdExec,
+		"DISCARD":       cmdDiscard,
+	}
+}
+
+// Options configures a Server.
+type Options struct {
+	// Addr is the TCP address to listen on, e.g. ":6380".
+	Addr string
+	// Password, when non-empty, requires clients to run AUTH before any
+	// other command succeeds.
+	Password string
+}
+
+// Server serves a youdb.DB over the Redis RESP protocol.
+type Server struct {
+	db   *youdb.DB
+	opts Options
+	ln   net.Listener
+}
+
+// New wraps db for network access according to opts.
+func New(db *youdb.DB, opts Options) *Server {
+	return &Server{db: db, opts: opts}
+}
+
+// ListenAndServe opens the configured TCP address and serves connections
+// until the listener is closed or accept fails.
+func (s *Server) ListenAndServe() error {
+	ln, err := net.Listen("tcp", s.opts.Addr)
+	if err != nil {
+		return err
+	}
+	s.ln = ln
+	for {
+		c, err := ln.Accept()
+		if err != nil {
+			return err
+		}
+		go s.serve(c)
+	}
+}
+
+// Close stops accepting new connections.
+func (s *Server) Close() error {
+	if s.ln == nil {
+		return nil
+	}
+	return s.ln.Close()
+}
+
+// conn tracks the per-connection state a handful of commands need: whether
+// AUTH has succeeded yet, and a queued MULTI/EXEC transaction.
+type conn struct {
+	rw         net.Conn
+	r          *bufio.Reader
+	w          *bufio.Writer
+	authed     bool
+	queuedCmds [][]string
+	inMulti    bool
+}
+
+func (s *Server) serve(rw net.Conn) {
+	defer rw.Close()
+	c := &conn{
+		rw:     rw,
+		r:      bufio.NewReader(rw),
+		w:      bufio.NewWriter(rw),
+		authed: s.opts.Password == "",
+	}
+	for {
+		args, err := readCommand(c.r)
+		if err != nil {
+			if err != io.EOF {
+				log.Printf("server: %s: %v", rw.RemoteAddr(), err)
+			}
+			return
+		}
+		if len(args) == 0 {
+			continue
+		}
+		if err := s.dispatch(c, args); err != nil {
+			return
+		}
+		if err := c.w.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+func (s *Server) dispatch(c *conn, args []string) error {
+	name := strings.ToUpper(args[0])
+
+	if !c.authed && name != "AUTH" {
+		return writeError(c.w, "NOAUTH Authentication required")
+	}
+
+	if c.inMulti && name != "EXEC" && name != "DISCARD" && name != "MULTI" {
+		if _, ok := handlers[name]; !ok {
+			return writeError(c.w, "unknown command '"+args[0]+"'")
+		}
+		c.queuedCmds = append(c.queuedCmds, args)
+		return writeSimpleString(c.w, "QUEUED")
+	}
+
+	h, ok := handlers[name]
+	if !ok {
+		return writeError(c.w, "unknown command '"+args[0]+"'")
+	}
+	return h(s, c, args)
+}
@@ -0,0 +1,251 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pythonsite/youdb"
+)
+
+// TestReadCommandRejectsOversizedArrayHeader guards the crash this request
+// fixes: a garbage array-length header must fail as a protocol error
+// instead of driving make([]string, 0, n) to try to allocate it.
+func TestReadCommandRejectsOversizedArrayHeader(t *testing.T) {
+	r := bufio.NewReader(strings.NewReader("*2000000000\r\n"))
+	if _, err := readCommand(r); err != errProtocol {
+		t.Fatalf("expected errProtocol for an oversized array header, got %v", err)
+	}
+}
+
+// TestReadCommandRejectsOversizedBulkHeader is readCommand's bulk-string
+// counterpart: a garbage $size header must fail the same way instead of
+// driving make([]byte, size+2).
+func TestReadCommandRejectsOversizedBulkHeader(t *testing.T) {
+	r := bufio.NewReader(strings.NewReader("*1\r\n$2000000000\r\n"))
+	if _, err := readCommand(r); err != errProtocol {
+		t.Fatalf("expected errProtocol for an oversized bulk header, got %v", err)
+	}
+}
+
+func TestReadCommandRoundTrip(t *testing.T) {
+	r := bufio.NewReader(strings.NewReader("*2\r\n$4\r\nHGET\r\n$1\r\na\r\n"))
+	args, err := readCommand(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"HGET", "a"}
+	if len(args) != len(want) || args[0] != want[0] || args[1] != want[1] {
+		t.Fatalf("got %v, want %v", args, want)
+	}
+}
+
+// testServer starts a Server on the loopback interface and returns an
+// address to dial, closing the server when the test ends.
+func testServer(t *testing.T, opts Options) string {
+	db, err := youdb.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	opts.Addr = "127.0.0.1:0"
+	s := New(db, opts)
+	ln, err := net.Listen("tcp", opts.Addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.ln = ln
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(c)
+		}
+	}()
+	t.Cleanup(func() { s.Close() })
+	return ln.Addr().String()
+}
+
+// cmdConn is a small RESP test client: send writes one command as an array
+// of bulk strings, readLines reads back n raw CRLF-terminated lines.
+type cmdConn struct {
+	t    *testing.T
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func dial(t *testing.T, addr string) *cmdConn {
+	c, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return &cmdConn{t: t, conn: c, r: bufio.NewReader(c)}
+}
+
+func (c *cmdConn) send(args ...string) {
+	var buf bytes.Buffer
+	buf.WriteString("*" + strconv.Itoa(len(args)) + "\r\n")
+	for _, a := range args {
+		buf.WriteString("$" + strconv.Itoa(len(a)) + "\r\n" + a + "\r\n")
+	}
+	if _, err := c.conn.Write(buf.Bytes()); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+func (c *cmdConn) readLine() string {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	return strings.TrimRight(line, "\r\n")
+}
+
+func TestServerRequiresAuthBeforeCommands(t *testing.T) {
+	addr := testServer(t, Options{Password: "secret"})
+	c := dial(t, addr)
+
+	c.send("PING")
+	if line := c.readLine(); !strings.Contains(line, "NOAUTH") {
+		t.Fatalf("expected NOAUTH before AUTH, got %q", line)
+	}
+
+	c.send("AUTH", "wrong")
+	if line := c.readLine(); !strings.HasPrefix(line, "-ERR") {
+		t.Fatalf("expected an error for a wrong password, got %q", line)
+	}
+
+	c.send("AUTH", "secret")
+	if line := c.readLine(); line != "+OK" {
+		t.Fatalf("expected +OK after a correct AUTH, got %q", line)
+	}
+
+	c.send("PING")
+	if line := c.readLine(); line != "+PONG" {
+		t.Fatalf("expected +PONG once authed, got %q", line)
+	}
+}
+
+func TestServerHsetHgetRoundTrip(t *testing.T) {
+	addr := testServer(t, Options{})
+	c := dial(t, addr)
+
+	c.send("HSET", "h", "k", "v")
+	if line := c.readLine(); line != ":1" {
+		t.Fatalf("expected :1 from HSET, got %q", line)
+	}
+
+	c.send("HGET", "h", "k")
+	if line := c.readLine(); line != "$1" {
+		t.Fatalf("expected a 1-byte bulk reply header, got %q", line)
+	}
+	if line := c.readLine(); line != "v" {
+		t.Fatalf("expected bulk payload %q, got %q", "v", line)
+	}
+}
+
+func TestServerZrangebyscoreUsesZrangebyscore(t *testing.T) {
+	addr := testServer(t, Options{})
+	c := dial(t, addr)
+
+	c.send("ZADD", "z", "1", "a")
+	c.readLine()
+	c.send("ZADD", "z", "2", "b")
+	c.readLine()
+	c.send("ZADD", "z", "3", "c")
+	c.readLine()
+
+	c.send("ZRANGEBYSCORE", "z", "2", "3")
+	if line := c.readLine(); line != "*4" {
+		t.Fatalf("expected 2 key/score pairs (4 elements), got %q", line)
+	}
+	c.readLine() // $1
+	if k := c.readLine(); k != "b" {
+		t.Fatalf("expected the first key in range to be b, got %q", k)
+	}
+	c.readLine() // $8 (score length)
+	c.readLine() // score value (8-byte big-endian)
+	c.readLine() // $1
+	if k := c.readLine(); k != "c" {
+		t.Fatalf("expected the second key in range to be c, got %q", k)
+	}
+}
+
+func TestServerMultiExecIsAtomicAndSeesOwnWrites(t *testing.T) {
+	addr := testServer(t, Options{})
+	c := dial(t, addr)
+
+	c.send("MULTI")
+	if line := c.readLine(); line != "+OK" {
+		t.Fatalf("expected +OK from MULTI, got %q", line)
+	}
+
+	c.send("HSET", "h", "k", "v")
+	if line := c.readLine(); line != "+QUEUED" {
+		t.Fatalf("expected +QUEUED, got %q", line)
+	}
+	c.send("HGET", "h", "k")
+	if line := c.readLine(); line != "+QUEUED" {
+		t.Fatalf("expected +QUEUED, got %q", line)
+	}
+
+	c.send("EXEC")
+	if line := c.readLine(); line != "*2" {
+		t.Fatalf("expected a 2-element reply array, got %q", line)
+	}
+	if line := c.readLine(); line != ":1" {
+		t.Fatalf("expected HSET's reply :1, got %q", line)
+	}
+	if line := c.readLine(); line != "$1" {
+		t.Fatalf("expected HGET to see the HSET queued just before it, got header %q", line)
+	}
+	if line := c.readLine(); line != "v" {
+		t.Fatalf("expected HGET's bulk payload %q, got %q", "v", line)
+	}
+}
+
+func TestServerDiscardDropsQueuedCommands(t *testing.T) {
+	addr := testServer(t, Options{})
+	c := dial(t, addr)
+
+	c.send("MULTI")
+	c.readLine()
+	c.send("HSET", "h", "k", "v")
+	c.readLine()
+	c.send("DISCARD")
+	if line := c.readLine(); line != "+OK" {
+		t.Fatalf("expected +OK from DISCARD, got %q", line)
+	}
+
+	c.send("HGET", "h", "k")
+	if line := c.readLine(); line != "$-1" {
+		t.Fatalf("expected the discarded HSET to never have run, got %q", line)
+	}
+}
+
+func TestServerServeTimesOutNeverHangsOnGarbageHeader(t *testing.T) {
+	addr := testServer(t, Options{})
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(2 * time.Second))
+	if _, err := conn.Write([]byte("*2000000000\r\n")); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 1)
+	if _, err := conn.Read(buf); err == nil {
+		t.Fatal("expected the connection to be closed after a protocol error")
+	}
+}
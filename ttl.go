@@ -0,0 +1,315 @@
+package youdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"time"
+)
+
+// expKeyPrefix and expPtrPrefix back the internal expiration zset: expKeyPrefix
+// is keyed by unix-nano expiry time followed by a pointer at the expiring
+// entry, expPtrPrefix maps that same pointer back to its current expiry time
+// so a re-Hsetex/Zexpire can find and drop the old expKeyPrefix entry, the
+// same key/score bucket pairing Zset uses for zetKeyPrefix/zetScorePrefix.
+var (
+	expKeyPrefix = []byte{28}
+	expPtrPrefix = []byte{27}
+)
+
+// encodeExpPtr packs the bucket kind, hashmap/zset name and entry key into
+// one value so expKeyPrefix/expPtrPrefix can point at any entry in the DB.
+func encodeExpPtr(bucketType byte, name string, key []byte) []byte {
+	nameLen := make([]byte, 2)
+	binary.BigEndian.PutUint16(nameLen, uint16(len(name)))
+	return Bconcat([][]byte{{bucketType}, nameLen, S2b(name), key})
+}
+
+func decodeExpPtr(ptr []byte) (bucketType byte, name string, key []byte) {
+	bucketType = ptr[0]
+	nameLen := binary.BigEndian.Uint16(ptr[1:3])
+	name = string(ptr[3 : 3+nameLen])
+	key = ptr[3+nameLen:]
+	return
+}
+
+// setExpire points an internal expiration zset entry at (bucketType, name,
+// key), replacing any expiry it already had.
+func (db *DB) setExpire(bucketType byte, name string, key []byte, ttl time.Duration) error {
+	ptr := encodeExpPtr(bucketType, name, key)
+	score := I2b(uint64(time.Now().Add(ttl).UnixNano()))
+	newKey := Bconcat([][]byte{score, ptr})
+
+	return db.Update(func(tx BackendTx) error {
+		b1, err := tx.CreateBucketIfNotExists(expKeyPrefix)
+		if err != nil {
+			return err
+		}
+		b2, err := tx.CreateBucketIfNotExists(expPtrPrefix)
+		if err != nil {
+			return err
+		}
+		oldScore := b2.Get(ptr)
+		if bytes.Equal(oldScore, score) {
+			return nil
+		}
+		if err := b1.Put(newKey, []byte{}); err != nil {
+			return err
+		}
+		if err := b2.Put(ptr, score); err != nil {
+			return err
+		}
+		if oldScore != nil {
+			return b1.Delete(Bconcat([][]byte{oldScore, ptr}))
+		}
+		return nil
+	})
+}
+
+// clearExpire removes any expiration previously set on (bucketType, name,
+// key), e.g. because the entry itself was deleted.
+func (db *DB) clearExpire(bucketType byte, name string, key []byte) error {
+	return db.Update(func(tx BackendTx) error {
+		return clearExpireTx(tx, bucketType, name, key)
+	})
+}
+
+// clearExpireTx is clearExpire's body, usable inside a transaction a caller
+// already holds, such as a Batch.
+func clearExpireTx(tx BackendTx, bucketType byte, name string, key []byte) error {
+	ptr := encodeExpPtr(bucketType, name, key)
+	b1 := tx.Bucket(expKeyPrefix)
+	b2 := tx.Bucket(expPtrPrefix)
+	if b1 == nil || b2 == nil {
+		return nil
+	}
+	oldScore := b2.Get(ptr)
+	if oldScore == nil {
+		return nil
+	}
+	if err := b1.Delete(Bconcat([][]byte{oldScore, ptr})); err != nil {
+		return err
+	}
+	return b2.Delete(ptr)
+}
+
+// expireAtNano returns the unix-nano expiry time for (bucketType, name,
+// key), and false if it has no expiration set.
+func (db *DB) expireAtNano(bucketType byte, name string, key []byte) (uint64, bool) {
+	ptr := encodeExpPtr(bucketType, name, key)
+	var expireAt uint64
+	found := false
+	db.View(func(tx BackendTx) error {
+		b := tx.Bucket(expPtrPrefix)
+		if b == nil {
+			return nil
+		}
+		if raw := b.Get(ptr); raw != nil {
+			expireAt = B2i(raw)
+			found = true
+		}
+		return nil
+	})
+	return expireAt, found
+}
+
+// purgeIfExpired deletes (bucketType, name, key) and its expiration entry if
+// it has expired, returning whether it did.
+func (db *DB) purgeIfExpired(bucketType byte, name string, key []byte) bool {
+	expireAt, ok := db.expireAtNano(bucketType, name, key)
+	if !ok || expireAt > uint64(time.Now().UnixNano()) {
+		return false
+	}
+	if bucketType == walBucketHash {
+		db.Hdel(name, key)
+	} else {
+		db.Zdel(name, key)
+	}
+	db.clearExpire(bucketType, name, key)
+	return true
+}
+
+// Hsetex is Hset followed by an expiration of ttl on the new entry.
+func (db *DB) Hsetex(name string, key, val []byte, ttl time.Duration) error {
+	if err := db.Hset(name, key, val); err != nil {
+		return err
+	}
+	return db.setExpire(walBucketHash, name, key, ttl)
+}
+
+// Hexpire sets ttl as the expiration of an existing hashmap entry.
+func (db *DB) Hexpire(name string, key []byte, ttl time.Duration) error {
+	r := db.Hget(name, key)
+	if r.State != replyOK {
+		return errors.New(r.State)
+	}
+	return db.setExpire(walBucketHash, name, key, ttl)
+}
+
+// Httl returns the remaining time to live of a hashmap entry. It returns -1
+// if the entry exists but has no expiration set.
+func (db *DB) Httl(name string, key []byte) (time.Duration, error) {
+	r := db.Hget(name, key)
+	if r.State != replyOK {
+		return 0, errors.New(r.State)
+	}
+	expireAt, ok := db.expireAtNano(walBucketHash, name, key)
+	if !ok {
+		return -1, nil
+	}
+	remain := time.Duration(expireAt - uint64(time.Now().UnixNano()))
+	if remain < 0 {
+		remain = 0
+	}
+	return remain, nil
+}
+
+// Zsetex is Zset followed by an expiration of ttl on the new entry.
+func (db *DB) Zsetex(name string, key []byte, val uint64, ttl time.Duration) error {
+	if err := db.Zset(name, key, val); err != nil {
+		return err
+	}
+	return db.setExpire(walBucketZset, name, key, ttl)
+}
+
+// Zexpire sets ttl as the expiration of an existing zset entry.
+func (db *DB) Zexpire(name string, key []byte, ttl time.Duration) error {
+	r := db.Zget(name, key)
+	if r.State != replyOK {
+		return errors.New(r.State)
+	}
+	return db.setExpire(walBucketZset, name, key, ttl)
+}
+
+// Zttl returns the remaining time to live of a zset entry. It returns -1 if
+// the entry exists but has no expiration set.
+func (db *DB) Zttl(name string, key []byte) (time.Duration, error) {
+	r := db.Zget(name, key)
+	if r.State != replyOK {
+		return 0, errors.New(r.State)
+	}
+	expireAt, ok := db.expireAtNano(walBucketZset, name, key)
+	if !ok {
+		return -1, nil
+	}
+	remain := time.Duration(expireAt - uint64(time.Now().UnixNano()))
+	if remain < 0 {
+		remain = 0
+	}
+	return remain, nil
+}
+
+// StartExpirer begins a background goroutine that wakes up every interval
+// and lazily deletes up to batch expired hash/zset entries per wake-up, by
+// scanning the internal expiration zset from its lowest expiry time up to
+// the current time. Calling it
+// again after StopExpirer restarts the loop.
+func (db *DB) StartExpirer(interval time.Duration, batch int) {
+	db.expirerStop = make(chan struct{})
+	go func() {
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C:
+				db.reapExpired(batch)
+			case <-db.expirerStop:
+				return
+			}
+		}
+	}()
+}
+
+// StopExpirer stops the background expiration loop started by StartExpirer.
+func (db *DB) StopExpirer() {
+	if db.expirerStop != nil {
+		close(db.expirerStop)
+		db.expirerStop = nil
+	}
+}
+
+// reapExpired scans the internal expiration zset from its start up to now
+// and deletes up to limit entries whose expiry has passed, along with the
+// hash/zset entry each one points at.
+func (db *DB) reapExpired(limit int) {
+	now := I2b(uint64(time.Now().UnixNano()))
+	var removed []expPtrEntry
+	db.Update(func(tx BackendTx) error {
+		b1 := tx.Bucket(expKeyPrefix)
+		if b1 == nil {
+			return nil
+		}
+		b2 := tx.Bucket(expPtrPrefix)
+
+		c := b1.Cursor()
+		var expired [][]byte
+		n := 0
+		for k, _ := c.Seek(I2b(0)); k != nil && n < limit; k, _ = c.Next() {
+			if bytes.Compare(k[:8], now) == 1 {
+				break
+			}
+			expired = append(expired, append([]byte{}, k...))
+			n++
+		}
+
+		for _, k := range expired {
+			ptr := k[8:]
+			bucketType, name, key := decodeExpPtr(ptr)
+			if deleteExpiredEntry(tx, bucketType, name, key) {
+				removed = append(removed, expPtrEntry{bucketType: bucketType, name: name, key: key})
+			}
+			if b2 != nil {
+				b2.Delete(ptr)
+			}
+			b1.Delete(k)
+		}
+		return nil
+	})
+	// Append one OpHdel/OpZdel per reaped entry, same as the lazy
+	// purgeIfExpired path does via Hdel/Zdel, so a WAL follower doesn't
+	// drift from background TTL reaping on the primary.
+	for _, e := range removed {
+		if e.bucketType == walBucketHash {
+			db.walAppend(Op{Opcode: OpHdel, Bucket: walBucketHash, Name: e.name, Key: e.key})
+		} else {
+			db.walAppend(Op{Opcode: OpZdel, Bucket: walBucketZset, Name: e.name, Key: e.key})
+		}
+	}
+}
+
+// expPtrEntry identifies one hash/zset entry reaped by reapExpired, kept
+// around so the WAL record can be appended after the backend transaction
+// that removed it has committed.
+type expPtrEntry struct {
+	bucketType byte
+	name       string
+	key        []byte
+}
+
+// deleteExpiredEntry removes the live hash or zset entry an expiration
+// pointer refers to, within the same transaction as the expiration bucket
+// cleanup in reapExpired. It reports whether an entry was actually removed.
+func deleteExpiredEntry(tx BackendTx, bucketType byte, name string, key []byte) bool {
+	if bucketType == walBucketHash {
+		b := tx.Bucket(Bconcat([][]byte{hashPrefix, S2b(name)}))
+		if b == nil || b.Get(key) == nil {
+			return false
+		}
+		b.Delete(key)
+		return true
+	}
+
+	scoreBucket := tx.Bucket(Bconcat([][]byte{zetScorePrefix, S2b(name)}))
+	if scoreBucket == nil {
+		return false
+	}
+	oldScore := scoreBucket.Get(key)
+	if oldScore == nil {
+		return false
+	}
+	if keyBucket := tx.Bucket(Bconcat([][]byte{zetKeyPrefix, S2b(name)})); keyBucket != nil {
+		keyBucket.Delete(Bconcat([][]byte{oldScore, key}))
+	}
+	scoreBucket.Delete(key)
+	return true
+}
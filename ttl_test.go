@@ -0,0 +1,177 @@
+package youdb
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestHsetexExpiresEntry(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := db.Hsetex("h", []byte("k"), []byte("v"), 10*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if r := db.Hget("h", []byte("k")); r.State != replyOK {
+		t.Fatalf("expected entry to be readable before expiry, got %q", r.State)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+
+	if r := db.Hget("h", []byte("k")); r.State == replyOK {
+		t.Fatal("expected entry to be gone once its ttl passed")
+	}
+}
+
+func TestHexpireOnMissingKeyErrors(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := db.Hexpire("h", []byte("missing"), time.Second); err == nil {
+		t.Fatal("expected Hexpire on a nonexistent key to error")
+	}
+}
+
+func TestHttlReportsNoExpirationAsNegativeOne(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := db.Hset("h", []byte("k"), []byte("v")); err != nil {
+		t.Fatal(err)
+	}
+	ttl, err := db.Httl("h", []byte("k"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ttl != -1 {
+		t.Fatalf("expected -1 for an entry with no expiration, got %v", ttl)
+	}
+}
+
+func TestHexpireReplacesPriorExpiration(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := db.Hsetex("h", []byte("k"), []byte("v"), time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Hexpire("h", []byte("k"), time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+
+	if r := db.Hget("h", []byte("k")); r.State != replyOK {
+		t.Fatal("expected the later, longer Hexpire to win over the original short ttl")
+	}
+	ttl, err := db.Httl("h", []byte("k"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ttl <= 0 || ttl > time.Hour {
+		t.Fatalf("expected a ttl close to 1h, got %v", ttl)
+	}
+}
+
+func TestZsetexExpiresEntry(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := db.Zsetex("z", []byte("k"), 1, 10*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(30 * time.Millisecond)
+
+	if r := db.Zget("z", []byte("k")); r.State == replyOK {
+		t.Fatal("expected zset entry to be gone once its ttl passed")
+	}
+}
+
+func TestReapExpiredRemovesExpiredEntriesOnly(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := db.Hsetex("h", []byte("soon"), []byte("v"), time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Hsetex("h", []byte("later"), []byte("v"), time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(20 * time.Millisecond)
+
+	db.reapExpired(100)
+
+	b := Bconcat([][]byte{hashPrefix, S2b("h")})
+	err = db.View(func(tx BackendTx) error {
+		bucket := tx.Bucket(b)
+		if bucket == nil {
+			t.Fatal("expected the hashmap bucket to still exist")
+		}
+		if v := bucket.Get([]byte("soon")); v != nil {
+			t.Fatal("expected the expired entry to have been reaped from the backend")
+		}
+		if v := bucket.Get([]byte("later")); v == nil {
+			t.Fatal("expected the entry with a long ttl to survive reaping")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestReapExpiredAppendsWAL ensures background TTL reaping is recorded in
+// the WAL, not just applied to the backend, so a replica following
+// ReplayFrom doesn't silently drift from the primary.
+func TestReapExpiredAppendsWAL(t *testing.T) {
+	base := t.TempDir()
+	db, err := OpenWithWAL(filepath.Join(base, "test.db"), WALOptions{Dir: filepath.Join(base, "wal")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := db.Hsetex("h", []byte("soon"), []byte("v"), time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(20 * time.Millisecond)
+
+	db.reapExpired(100)
+
+	var ops []Op
+	if err := db.ReplayFrom(0, func(op Op) error {
+		ops = append(ops, op)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	var sawDel bool
+	for _, op := range ops {
+		if op.Opcode == OpHdel && string(op.Key) == "soon" {
+			sawDel = true
+		}
+	}
+	if !sawDel {
+		t.Fatalf("expected an OpHdel for the reaped key %q in the WAL, got %v", "soon", ops)
+	}
+}
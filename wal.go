@@ -0,0 +1,500 @@
+package youdb
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Op opcodes, one per mutating method that can be replayed against a DB.
+const (
+	OpHset byte = iota + 1
+	OpHmset
+	OpHincr
+	OpHdel
+	OpHdelBucket
+	OpZset
+	OpZmset
+	OpZincr
+	OpZdel
+	OpZdelBucket
+)
+
+// Bucket type tags recorded alongside an Op, mirroring hashPrefix/zetKeyPrefix.
+const (
+	walBucketHash byte = 'h'
+	walBucketZset byte = 'z'
+)
+
+// FsyncPolicy controls how aggressively the WAL flushes to disk.
+type FsyncPolicy int
+
+const (
+	// FsyncAlways fsyncs after every append.
+	FsyncAlways FsyncPolicy = iota
+	// FsyncEverySec fsyncs once a second from a background goroutine.
+	FsyncEverySec
+	// FsyncNo leaves fsync timing to the operating system.
+	FsyncNo
+)
+
+const defaultSegmentSize int64 = 64 << 20 // 64MiB
+
+// WALOptions configures the append-only log opened alongside the bolt file.
+type WALOptions struct {
+	// Dir is where wal segment files are kept.
+	Dir string
+	// Fsync is the durability/throughput tradeoff for appends.
+	Fsync FsyncPolicy
+	// SegmentSize rotates to a new segment once the active one reaches this
+	// many bytes. Zero uses defaultSegmentSize.
+	SegmentSize int64
+}
+
+// Op is one replayable mutation: the opcode identifies which DB method
+// produced it, Bucket is walBucketHash or walBucketZset, Name is the
+// hashmap/zset name, Key is the entry key, and Value is either the hash
+// value or the 8-byte big-endian zset score; for OpHincr and OpZincr it is
+// the 8-byte big-endian step instead.
+type Op struct {
+	Opcode byte
+	Bucket byte
+	Name   string
+	Key    []byte
+	Value  []byte
+}
+
+// walSegment is one rotated log file; Start is the logical offset (as
+// returned by append and consumed by ReplayFrom/Tail) of its first byte.
+type walSegment struct {
+	path  string
+	start int64
+	size  int64
+}
+
+// wal is an append-only, length-prefixed, CRC-checked log of Ops, rotated
+// across segment files under a single directory.
+type wal struct {
+	mu       sync.Mutex
+	dir      string
+	fsync    FsyncPolicy
+	segSize  int64
+	segments []walSegment
+	f        *os.File
+	stopSync chan struct{}
+}
+
+func segmentPath(dir string, start int64) string {
+	return filepath.Join(dir, fmt.Sprintf("wal-%020d.log", start))
+}
+
+func newWAL(opts WALOptions) (*wal, error) {
+	if opts.Dir == "" {
+		return nil, errors.New("wal: Dir is required")
+	}
+	if err := os.MkdirAll(opts.Dir, 0700); err != nil {
+		return nil, err
+	}
+	segSize := opts.SegmentSize
+	if segSize <= 0 {
+		segSize = defaultSegmentSize
+	}
+
+	entries, err := os.ReadDir(opts.Dir)
+	if err != nil {
+		return nil, err
+	}
+	var segments []walSegment
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		var start int64
+		if _, err := fmt.Sscanf(e.Name(), "wal-%020d.log", &start); err != nil {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			return nil, err
+		}
+		segments = append(segments, walSegment{path: filepath.Join(opts.Dir, e.Name()), start: start, size: info.Size()})
+	}
+	sort.Slice(segments, func(i, j int) bool { return segments[i].start < segments[j].start })
+
+	w := &wal{dir: opts.Dir, fsync: opts.Fsync, segSize: segSize, segments: segments}
+	if len(segments) == 0 {
+		w.segments = []walSegment{{path: segmentPath(opts.Dir, 0), start: 0, size: 0}}
+	}
+
+	active := w.segments[len(w.segments)-1]
+	f, err := os.OpenFile(active.path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+	w.f = f
+
+	if w.fsync == FsyncEverySec {
+		w.stopSync = make(chan struct{})
+		go w.fsyncLoop()
+	}
+	return w, nil
+}
+
+func (w *wal) fsyncLoop() {
+	t := time.NewTicker(time.Second)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			w.mu.Lock()
+			if w.f != nil {
+				w.f.Sync()
+			}
+			w.mu.Unlock()
+		case <-w.stopSync:
+			return
+		}
+	}
+}
+
+// encodeOp serializes op as: opcode(1) bucket(1) nameLen(2) name keyLen(4) key valLen(4) value.
+func encodeOp(op Op) []byte {
+	buf := make([]byte, 0, 2+2+len(op.Name)+4+len(op.Key)+4+len(op.Value))
+	buf = append(buf, op.Opcode, op.Bucket)
+	nameLen := make([]byte, 2)
+	binary.BigEndian.PutUint16(nameLen, uint16(len(op.Name)))
+	buf = append(buf, nameLen...)
+	buf = append(buf, op.Name...)
+	keyLen := make([]byte, 4)
+	binary.BigEndian.PutUint32(keyLen, uint32(len(op.Key)))
+	buf = append(buf, keyLen...)
+	buf = append(buf, op.Key...)
+	valLen := make([]byte, 4)
+	binary.BigEndian.PutUint32(valLen, uint32(len(op.Value)))
+	buf = append(buf, valLen...)
+	buf = append(buf, op.Value...)
+	return buf
+}
+
+func decodeOp(payload []byte) (Op, error) {
+	if len(payload) < 2+2 {
+		return Op{}, errors.New("wal: truncated record")
+	}
+	op := Op{Opcode: payload[0], Bucket: payload[1]}
+	p := payload[2:]
+
+	nameLen := int(binary.BigEndian.Uint16(p[:2]))
+	p = p[2:]
+	if len(p) < nameLen+4 {
+		return Op{}, errors.New("wal: truncated record")
+	}
+	op.Name = string(p[:nameLen])
+	p = p[nameLen:]
+
+	keyLen := int(binary.BigEndian.Uint32(p[:4]))
+	p = p[4:]
+	if len(p) < keyLen+4 {
+		return Op{}, errors.New("wal: truncated record")
+	}
+	op.Key = p[:keyLen]
+	p = p[keyLen:]
+
+	valLen := int(binary.BigEndian.Uint32(p[:4]))
+	p = p[4:]
+	if len(p) < valLen {
+		return Op{}, errors.New("wal: truncated record")
+	}
+	op.Value = p[:valLen]
+	return op, nil
+}
+
+// append writes op as one length-prefixed, CRC-checked record and returns
+// the logical offset it was written at.
+func (w *wal) append(op Op) (int64, error) {
+	payload := encodeOp(op)
+	header := make([]byte, 8)
+	binary.BigEndian.PutUint32(header[:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(header[4:], crc32.ChecksumIEEE(payload))
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	active := &w.segments[len(w.segments)-1]
+	offset := active.start + active.size
+
+	if _, err := w.f.Write(header); err != nil {
+		return 0, err
+	}
+	if _, err := w.f.Write(payload); err != nil {
+		return 0, err
+	}
+	if w.fsync == FsyncAlways {
+		if err := w.f.Sync(); err != nil {
+			return 0, err
+		}
+	}
+	active.size += int64(len(header) + len(payload))
+
+	if active.size >= w.segSize {
+		if err := w.f.Close(); err != nil {
+			return 0, err
+		}
+		next := walSegment{path: segmentPath(w.dir, active.start+active.size), start: active.start + active.size, size: 0}
+		f, err := os.OpenFile(next.path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0600)
+		if err != nil {
+			return 0, err
+		}
+		w.f = f
+		w.segments = append(w.segments, next)
+	}
+	return offset, nil
+}
+
+func (w *wal) close() error {
+	if w.stopSync != nil {
+		close(w.stopSync)
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.f.Close()
+}
+
+// replay reads every record in segments starting from the one containing
+// offset, calling fn for each decoded Op in log order.
+func (w *wal) replay(offset int64, fn func(Op) error) error {
+	w.mu.Lock()
+	segments := make([]walSegment, len(w.segments))
+	copy(segments, w.segments)
+	w.mu.Unlock()
+
+	for _, seg := range segments {
+		if seg.start+seg.size <= offset {
+			continue
+		}
+		if err := replaySegment(seg, offset, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// replaySegment decodes and applies every complete record in seg from
+// offset onward. A short final read (io.ErrUnexpectedEOF) is the normal
+// result of a crash mid-append, so it ends replay cleanly at the last
+// complete record rather than failing it.
+func replaySegment(seg walSegment, offset int64, fn func(Op) error) error {
+	f, err := os.Open(seg.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+
+	pos := seg.start
+	skip := offset - seg.start
+	if skip < 0 {
+		skip = 0
+	}
+
+	header := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(f, header); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return nil
+			}
+			return err
+		}
+		size := binary.BigEndian.Uint32(header[:4])
+		wantCRC := binary.BigEndian.Uint32(header[4:])
+
+		payload := make([]byte, size)
+		if _, err := io.ReadFull(f, payload); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return nil
+			}
+			return err
+		}
+		recordLen := int64(8 + size)
+		if pos-seg.start >= skip {
+			if crc32.ChecksumIEEE(payload) != wantCRC {
+				return fmt.Errorf("wal: corrupt record at offset %d", pos)
+			}
+			op, err := decodeOp(payload)
+			if err != nil {
+				return err
+			}
+			if err := fn(op); err != nil {
+				return err
+			}
+		}
+		pos += recordLen
+	}
+}
+
+// ReplayFrom calls apply, in log order, for every Op recorded at or after
+// offset. Pass 0 to replay the whole log. It requires the DB to have been
+// opened with OpenWithWAL.
+func (db *DB) ReplayFrom(offset int64, apply func(op Op) error) error {
+	if db.wal == nil {
+		return errors.New("youdb: WAL is not enabled, open with OpenWithWAL")
+	}
+	return db.wal.replay(offset, apply)
+}
+
+// Tail streams every Op recorded at or after offset, then keeps streaming
+// new ones as they are appended until ctx is cancelled. The returned
+// channel is closed when ctx is done or a read error occurs.
+func (db *DB) Tail(ctx context.Context, offset int64) <-chan Op {
+	out := make(chan Op)
+	go func() {
+		defer close(out)
+		next := offset
+		for {
+			err := db.wal.replay(next, func(op Op) error {
+				select {
+				case out <- op:
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+				next += int64(8 + len(encodeOp(op)))
+				return nil
+			})
+			if err != nil {
+				return
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(100 * time.Millisecond):
+			}
+		}
+	}()
+	return out
+}
+
+// Apply performs op against db's own hash/zset state through db's ordinary
+// mutating methods, so if db has a WAL of its own the op is appended there
+// too. Replicas consuming Tail/ReplayFrom from a primary call this to catch
+// up.
+func (db *DB) Apply(op Op) error {
+	switch op.Opcode {
+	case OpHset, OpHmset:
+		return db.Hset(op.Name, op.Key, op.Value)
+	case OpHincr:
+		_, err := db.Hincr(op.Name, op.Key, B2i(op.Value))
+		return err
+	case OpHdel:
+		return db.Hdel(op.Name, op.Key)
+	case OpHdelBucket:
+		return db.HdelBucket(op.Name)
+	case OpZset, OpZmset:
+		return db.Zset(op.Name, op.Key, B2i(op.Value))
+	case OpZincr:
+		_, err := db.Zincr(op.Name, op.Key, B2i(op.Value))
+		return err
+	case OpZdel:
+		return db.Zdel(op.Name, op.Key)
+	case OpZdelBucket:
+		return db.ZdelBucket(op.Name)
+	default:
+		return fmt.Errorf("youdb: unknown WAL opcode %d", op.Opcode)
+	}
+}
+
+// Compact rewrites the WAL as a single minimal snapshot segment: one Hset
+// or Zset op per live entry in the current bolt state, discarding the
+// history of updates/deletes that produced it. Use after ReplayFrom has
+// caught replicas up, or to bound log growth on a long-running DB.
+func (db *DB) Compact() error {
+	if db.wal == nil {
+		return errors.New("youdb: WAL is not enabled, open with OpenWithWAL")
+	}
+	w := db.wal
+
+	snapshotPath := filepath.Join(w.dir, "wal-snapshot.tmp")
+	f, err := os.OpenFile(snapshotPath, os.O_CREATE|os.O_TRUNC|os.O_RDWR, 0600)
+	if err != nil {
+		return err
+	}
+
+	writeOp := func(op Op) error {
+		payload := encodeOp(op)
+		header := make([]byte, 8)
+		binary.BigEndian.PutUint32(header[:4], uint32(len(payload)))
+		binary.BigEndian.PutUint32(header[4:], crc32.ChecksumIEEE(payload))
+		if _, err := f.Write(header); err != nil {
+			return err
+		}
+		_, err := f.Write(payload)
+		return err
+	}
+
+	err = db.View(func(tx BackendTx) error {
+		return tx.ForEach(func(name []byte, b BackendBucket) error {
+			if len(name) == 0 {
+				return nil
+			}
+			switch name[0] {
+			case hashPrefix[0]:
+				c := b.Cursor()
+				for k, v := c.Seek(nil); k != nil; k, v = c.Next() {
+					if err := writeOp(Op{Opcode: OpHset, Bucket: walBucketHash, Name: string(name[1:]), Key: k, Value: v}); err != nil {
+						return err
+					}
+				}
+			case zetScorePrefix[0]:
+				c := b.Cursor()
+				for k, v := c.Seek(nil); k != nil; k, v = c.Next() {
+					if err := writeOp(Op{Opcode: OpZset, Bucket: walBucketZset, Name: string(name[1:]), Key: k, Value: v}); err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		f.Close()
+		os.Remove(snapshotPath)
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if err := w.f.Close(); err != nil {
+		return err
+	}
+	for _, seg := range w.segments {
+		os.Remove(seg.path)
+	}
+	finalPath := segmentPath(w.dir, 0)
+	if err := os.Rename(snapshotPath, finalPath); err != nil {
+		return err
+	}
+	nf, err := os.OpenFile(finalPath, os.O_RDWR|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	w.f = nf
+	w.segments = []walSegment{{path: finalPath, start: 0, size: info.Size()}}
+	return nil
+}
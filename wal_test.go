@@ -0,0 +1,59 @@
+package youdb
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestReplayFromTruncatedTrailingRecord exercises the scenario replaySegment
+// is built for: a crash mid-append leaves a short, incomplete record at the
+// end of the active segment. Replay should stop cleanly there instead of
+// failing the whole recovery.
+func TestReplayFromTruncatedTrailingRecord(t *testing.T) {
+	base := t.TempDir()
+	walDir := filepath.Join(base, "wal")
+	db, err := OpenWithWAL(filepath.Join(base, "test.db"), WALOptions{Dir: walDir})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.Hset("h", []byte("a"), []byte("1")); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Hset("h", []byte("b"), []byte("2")); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	segPath := segmentPath(walDir, 0)
+	info, err := os.Stat(segPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Truncate(segPath, info.Size()-3); err != nil {
+		t.Fatal(err)
+	}
+
+	db2, err := OpenWithWAL(filepath.Join(base, "test.db"), WALOptions{Dir: walDir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db2.Close()
+
+	var ops []Op
+	if err := db2.ReplayFrom(0, func(op Op) error {
+		ops = append(ops, op)
+		return nil
+	}); err != nil {
+		t.Fatalf("ReplayFrom: expected a truncated trailing record to end replay cleanly, got error: %v", err)
+	}
+	if len(ops) != 1 {
+		t.Fatalf("expected the one complete record to replay, got %d", len(ops))
+	}
+	if string(ops[0].Key) != "a" {
+		t.Fatalf("expected the first (complete) record's key %q, got %q", "a", ops[0].Key)
+	}
+}
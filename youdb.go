@@ -6,10 +6,8 @@ import (
 	"encoding/binary"
 	"encoding/json"
 	"errors"
-	"github.com/boltdb/bolt"
 	"reflect"
 	"strconv"
-	"time"
 	"unsafe"
 )
 
@@ -32,9 +30,11 @@ var (
 
 type (
 	bs []byte
-	// DB embeds a bolt.DB
+	// DB stores hash and zset data on a pluggable Backend (bolt by default).
 	DB struct {
-		*bolt.DB
+		backend     Backend
+		wal         *wal
+		expirerStop chan struct{}
 	}
 
 	// Reply a holder for a Entry list of a hashmap
@@ -49,33 +49,87 @@ type (
 	}
 )
 
-// Open creates/opens a bolt.DB at specified path, and returns a DB enclosing the same
-func Open(path string) (*DB, error) {
-	database, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 1 * time.Second})
+// Open creates/opens a DB at the specified path, using the bolt backend
+// unless overridden with WithBackend.
+func Open(path string, opts ...Option) (*DB, error) {
+	cfg := openConfig{backend: "bolt"}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	backend, err := newBackend(cfg.backend, path)
 	if err != nil {
 		return nil, err
 	}
 
-	db := DB{database}
+	return &DB{backend: backend}, nil
+}
 
-	return &db, nil
+// OpenWithWAL is like Open, but also opens an append-only log under
+// walOpts.Dir: every mutation is appended there after the corresponding
+// bolt transaction has committed, so a replica or recovery tool can follow
+// along with ReplayFrom/Tail without re-reading the whole bolt file. The
+// record is not written before the commit: if the append fails, the
+// mutation stays in bolt with no WAL record and the method returns the
+// append error.
+func OpenWithWAL(path string, walOpts WALOptions) (*DB, error) {
+	db, err := Open(path)
+	if err != nil {
+		return nil, err
+	}
+	w, err := newWAL(walOpts)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	db.wal = w
+	return db, nil
 }
 
-// Close closes the embedded bolt.DB
+// Close closes the underlying Backend, and the WAL if one is open.
 func (db *DB) Close() error {
-	return db.DB.Close()
+	if db.wal != nil {
+		if err := db.wal.close(); err != nil {
+			db.backend.Close()
+			return err
+		}
+	}
+	return db.backend.Close()
+}
+
+// View runs fn in a read-only transaction against db's Backend.
+func (db *DB) View(fn func(tx BackendTx) error) error {
+	return db.backend.View(fn)
+}
+
+// Update runs fn in a read-write transaction against db's Backend.
+func (db *DB) Update(fn func(tx BackendTx) error) error {
+	return db.backend.Update(fn)
+}
+
+// walAppend records op in the WAL, if one is enabled. It is a no-op
+// otherwise, so every mutating method can call it unconditionally.
+func (db *DB) walAppend(op Op) error {
+	if db.wal == nil {
+		return nil
+	}
+	_, err := db.wal.append(op)
+	return err
 }
 
 // Hset set the byte value in argument as value of the key of a hashmap
 func (db *DB) Hset(name string, key, val []byte) error {
 	bucketName := Bconcat([][]byte{hashPrefix, S2b(name)})
-	return db.DB.Update(func(tx *bolt.Tx) error {
+	if err := db.Update(func(tx BackendTx) error {
 		b, err := tx.CreateBucketIfNotExists(bucketName)
 		if err != nil {
 			return err
 		}
 		return b.Put(key, val)
-	})
+	}); err != nil {
+		return err
+	}
+	return db.walAppend(Op{Opcode: OpHset, Bucket: walBucketHash, Name: name, Key: key, Value: val})
 }
 
 // Hmset set multiple key-value pairs of a hashmap in one method call
@@ -84,7 +138,7 @@ func (db *DB) Hmset(name string, kvs ...[]byte) error {
 		return errors.New("kvs len must is an even number")
 	}
 	bucketName := Bconcat([][]byte{hashPrefix, S2b(name)})
-	return db.DB.Update(func(tx *bolt.Tx) error {
+	if err := db.Update(func(tx BackendTx) error {
 		b, err := tx.CreateBucketIfNotExists(bucketName)
 		if err != nil {
 			return err
@@ -96,14 +150,22 @@ func (db *DB) Hmset(name string, kvs ...[]byte) error {
 			}
 		}
 		return nil
-	})
+	}); err != nil {
+		return err
+	}
+	for i := 0; i < (len(kvs) - 1); i += 2 {
+		if err := db.walAppend(Op{Opcode: OpHmset, Bucket: walBucketHash, Name: name, Key: kvs[i], Value: kvs[i+1]}); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // Hincr increment the number stored at key in a hashmap by step
 func (db *DB) Hincr(name string, key []byte, step uint64) (uint64, error) {
 	var i uint64
 	bucketName := Bconcat([][]byte{hashPrefix, S2b(name)})
-	err := db.DB.Update(func(tx *bolt.Tx) error {
+	err := db.Update(func(tx BackendTx) error {
 		b, err := tx.CreateBucketIfNotExists(bucketName)
 		if err != nil {
 			return err
@@ -131,27 +193,43 @@ func (db *DB) Hincr(name string, key []byte, step uint64) (uint64, error) {
 		i = oldNum
 		return nil
 	})
-	return i, err
+	if err != nil {
+		return 0, err
+	}
+	if err := db.walAppend(Op{Opcode: OpHincr, Bucket: walBucketHash, Name: name, Key: key, Value: I2b(step)}); err != nil {
+		return 0, err
+	}
+	return i, nil
 }
 
 // Hdel delete specified key of a hashmap
 func (db *DB) Hdel(name string, key []byte) error {
 	bucketName := Bconcat([][]byte{hashPrefix, S2b(name)})
-	return db.DB.Update(func(tx *bolt.Tx) error {
+	err := db.Update(func(tx BackendTx) error {
 		b := tx.Bucket(bucketName)
 		if b != nil {
 			return b.Delete(key)
 		}
 		return nil
 	})
+	if err != nil {
+		return err
+	}
+	if err := db.walAppend(Op{Opcode: OpHdel, Bucket: walBucketHash, Name: name, Key: key}); err != nil {
+		return err
+	}
+	return db.clearExpire(walBucketHash, name, key)
 }
 
 // HdelBucket delete all keys in a hashmap
 func (db *DB) HdelBucket(name string) error {
 	bucketName := Bconcat([][]byte{hashPrefix, S2b(name)})
-	return db.DB.Update(func(tx *bolt.Tx) error {
+	if err := db.Update(func(tx BackendTx) error {
 		return tx.DeleteBucket(bucketName)
-	})
+	}); err != nil {
+		return err
+	}
+	return db.walAppend(Op{Opcode: OpHdelBucket, Bucket: walBucketHash, Name: name})
 }
 
 // Hget get the value related to the specified key of a hashmap
@@ -161,7 +239,7 @@ func (db *DB) Hget(name string, key []byte) *Reply {
 		Data:  []bs{},
 	}
 	bucketName := Bconcat([][]byte{hashPrefix, S2b(name)})
-	err := db.DB.View(func(tx *bolt.Tx) error {
+	err := db.View(func(tx BackendTx) error {
 		b := tx.Bucket(bucketName)
 		if b == nil {
 			return errors.New(bucketNotFound)
@@ -177,6 +255,10 @@ func (db *DB) Hget(name string, key []byte) *Reply {
 	if err != nil {
 		r.State = err.Error()
 	}
+	if r.State == replyOK && db.purgeIfExpired(walBucketHash, name, key) {
+		r.State = keyNotFound
+		r.Data = []bs{}
+	}
 	return r
 }
 
@@ -187,7 +269,7 @@ func (db *DB) Hmget(name string, keys [][]byte) *Reply {
 		Data:  []bs{},
 	}
 	bucketName := Bconcat([][]byte{hashPrefix, S2b(name)})
-	err := db.DB.View(func(tx *bolt.Tx) error {
+	err := db.View(func(tx BackendTx) error {
 		b := tx.Bucket(bucketName)
 		if b == nil {
 			return errors.New(bucketNotFound)
@@ -214,7 +296,7 @@ func (db *DB) Hscan(name string, keyStart []byte, limit int) *Reply {
 		Data:  []bs{},
 	}
 	bucketName := Bconcat([][]byte{hashPrefix, S2b(name)})
-	err := db.DB.View(func(tx *bolt.Tx) error {
+	err := db.View(func(tx BackendTx) error {
 		b := tx.Bucket(bucketName)
 		if b == nil {
 			return errors.New(bucketNotFound)
@@ -246,7 +328,7 @@ func (db *DB) Hrscan(name string, keyStart []byte, limit int) *Reply {
 		Data:  []bs{},
 	}
 	bucketName := Bconcat([][]byte{hashPrefix, S2b(name)})
-	err := db.DB.View(func(tx *bolt.Tx) error {
+	err := db.View(func(tx BackendTx) error {
 		b := tx.Bucket(bucketName)
 		if b == nil {
 			return errors.New(bucketNotFound)
@@ -285,7 +367,7 @@ func (db *DB) Zset(name string, key []byte, val uint64) error {
 	keyBucket := Bconcat([][]byte{zetKeyPrefix, S2b(name)})
 	scoreBucket := Bconcat([][]byte{zetScorePrefix, S2b(name)})
 	newKey := Bconcat([][]byte{score, key})
-	return db.DB.Update(func(tx *bolt.Tx) error {
+	if err := db.Update(func(tx BackendTx) error {
 		b1, err1 := tx.CreateBucketIfNotExists(keyBucket)
 		if err1 != nil {
 			return err1
@@ -316,7 +398,10 @@ func (db *DB) Zset(name string, key []byte, val uint64) error {
 			}
 		}
 		return nil
-	})
+	}); err != nil {
+		return err
+	}
+	return db.walAppend(Op{Opcode: OpZset, Bucket: walBucketZset, Name: name, Key: key, Value: score})
 }
 
 // Zmset et multiple key-score pairs of a zset in one method call
@@ -328,7 +413,7 @@ func (db *DB) Zmset(name string, kvs ...[]byte) error {
 	keyBucket := Bconcat([][]byte{zetKeyPrefix, S2b(name)})
 	scoreBucket := Bconcat([][]byte{zetScorePrefix, S2b(name)})
 
-	return db.DB.Update(func(tx *bolt.Tx) error {
+	if err := db.Update(func(tx BackendTx) error {
 		b1, err1 := tx.CreateBucketIfNotExists(keyBucket)
 		if err1 != nil {
 			return err1
@@ -365,7 +450,16 @@ func (db *DB) Zmset(name string, kvs ...[]byte) error {
 			}
 		}
 		return nil
-	})
+	}); err != nil {
+		return err
+	}
+
+	for i := 0; i < (len(kvs) - 1); i += 2 {
+		if err := db.walAppend(Op{Opcode: OpZmset, Bucket: walBucketZset, Name: name, Key: kvs[i], Value: kvs[i+1]}); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // Zincr increment the number stored at key in a zset by step
@@ -375,7 +469,7 @@ func (db *DB) Zincr(name string, key []byte, step uint64) (uint64, error) {
 	keyBucket := Bconcat([][]byte{zetKeyPrefix, S2b(name)})
 	scoreBucket := Bconcat([][]byte{zetScorePrefix, S2b(name)})
 
-	err := db.DB.Update(func(tx *bolt.Tx) error {
+	err := db.Update(func(tx BackendTx) error {
 		b1, err1 := tx.CreateBucketIfNotExists(keyBucket)
 		if err1 != nil {
 			return err1
@@ -422,14 +516,20 @@ func (db *DB) Zincr(name string, key []byte, step uint64) (uint64, error) {
 		}
 		return nil
 	})
-	return score, err
+	if err != nil {
+		return 0, err
+	}
+	if err := db.walAppend(Op{Opcode: OpZincr, Bucket: walBucketZset, Name: name, Key: key, Value: I2b(step)}); err != nil {
+		return 0, err
+	}
+	return score, nil
 }
 
 // Zdel delete specified key of a zset
 func (db *DB) Zdel(name string, key []byte) error {
 	keyBucket := Bconcat([][]byte{zetKeyPrefix, S2b(name)})
 	scoreBucket := Bconcat([][]byte{zetScorePrefix, S2b(name)})
-	return db.DB.Update(func(tx *bolt.Tx) error {
+	err := db.Update(func(tx BackendTx) error {
 		b1 := tx.Bucket(keyBucket)
 		if b1 == nil {
 			return nil
@@ -450,19 +550,29 @@ func (db *DB) Zdel(name string, key []byte) error {
 		}
 		return nil
 	})
+	if err != nil {
+		return err
+	}
+	if err := db.walAppend(Op{Opcode: OpZdel, Bucket: walBucketZset, Name: name, Key: key}); err != nil {
+		return err
+	}
+	return db.clearExpire(walBucketZset, name, key)
 }
 
 // ZdelBucket delete all keys in a zset
 func (db *DB) ZdelBucket(name string) error {
 	keyBucket := Bconcat([][]byte{zetKeyPrefix, S2b(name)})
 	scoreBucket := Bconcat([][]byte{zetScorePrefix, S2b(name)})
-	return db.DB.Update(func(tx *bolt.Tx) error {
+	if err := db.Update(func(tx BackendTx) error {
 		err := tx.DeleteBucket(keyBucket)
 		if err != nil {
 			return err
 		}
 		return tx.DeleteBucket(scoreBucket)
-	})
+	}); err != nil {
+		return err
+	}
+	return db.walAppend(Op{Opcode: OpZdelBucket, Bucket: walBucketZset, Name: name})
 }
 
 // Zget get the score related to the specified key of a zset
@@ -472,7 +582,7 @@ func (db *DB) Zget(name string, key []byte) *Reply {
 		Data:  []bs{},
 	}
 	scoreBucket := Bconcat([][]byte{zetScorePrefix, S2b(name)})
-	err := db.DB.View(func(tx *bolt.Tx) error {
+	err := db.View(func(tx BackendTx) error {
 		b := tx.Bucket(scoreBucket)
 		if b == nil {
 			return errors.New(bucketNotFound)
@@ -489,6 +599,10 @@ func (db *DB) Zget(name string, key []byte) *Reply {
 	if err != nil {
 		r.State = err.Error()
 	}
+	if r.State == replyOK && db.purgeIfExpired(walBucketZset, name, key) {
+		r.State = keyNotFound
+		r.Data = []bs{}
+	}
 	return r
 }
 
@@ -500,7 +614,7 @@ func (db *DB) Zmget(name string, keys [][]byte) *Reply {
 	}
 	scoreBucket := Bconcat([][]byte{zetScorePrefix, S2b(name)})
 
-	err := db.DB.View(func(tx *bolt.Tx) error {
+	err := db.View(func(tx BackendTx) error {
 		b := tx.Bucket(scoreBucket)
 		if b == nil {
 			return errors.New(bucketNotFound)
@@ -537,7 +651,7 @@ func (db *DB) Zscan(name string, keyStart, scoreStart []byte, limit int) *Reply
 
 	startScoreKeyB := Bconcat([][]byte{scoreStartB, keyStart})
 
-	err := db.DB.View(func(tx *bolt.Tx) error {
+	err := db.View(func(tx BackendTx) error {
 		b := tx.Bucket(keyBucket)
 		if b == nil {
 			return errors.New(bucketNotFound)
@@ -585,7 +699,7 @@ func (db *DB) Zrscan(name string, keyStart, scoreStart []byte, limit int) *Reply
 
 	startScoreKeyB := Bconcat([][]byte{scoreStartB, startKey})
 
-	err := db.DB.View(func(tx *bolt.Tx) error {
+	err := db.View(func(tx BackendTx) error {
 		b := tx.Bucket(keyBucket)
 		if b == nil {
 			return errors.New(bucketNotFound)
@@ -0,0 +1,117 @@
+package youdb
+
+import (
+	"bytes"
+	"errors"
+)
+
+// Zrangebyscore lists key-score pairs of a zset whose score is in
+// [min, max], skipping the first offset matches and collecting up to limit;
+// a limit of 0 or less collects every remaining match.
+func (db *DB) Zrangebyscore(name string, min, max uint64, offset, limit int) *Reply {
+	r := &Reply{
+		State: replyError,
+		Data:  []bs{},
+	}
+	keyBucket := Bconcat([][]byte{zetKeyPrefix, S2b(name)})
+	minB, maxB := I2b(min), I2b(max)
+
+	err := db.View(func(tx BackendTx) error {
+		b := tx.Bucket(keyBucket)
+		if b == nil {
+			return errors.New(bucketNotFound)
+		}
+		c := b.Cursor()
+		skipped, n := 0, 0
+		for k, _ := c.Seek(minB); k != nil && bytes.Compare(k[:8], maxB) <= 0; k, _ = c.Next() {
+			if skipped < offset {
+				skipped++
+				continue
+			}
+			r.State = replyOK
+			r.Data = append(r.Data, k[8:], k[0:8])
+			n++
+			if limit > 0 && n == limit {
+				break
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		r.State = err.Error()
+	}
+	return r
+}
+
+// Zcount counts the keys of a zset whose score is in [min, max].
+func (db *DB) Zcount(name string, min, max uint64) (uint64, error) {
+	keyBucket := Bconcat([][]byte{zetKeyPrefix, S2b(name)})
+	minB, maxB := I2b(min), I2b(max)
+
+	var n uint64
+	err := db.View(func(tx BackendTx) error {
+		b := tx.Bucket(keyBucket)
+		if b == nil {
+			return errors.New(bucketNotFound)
+		}
+		c := b.Cursor()
+		for k, _ := c.Seek(minB); k != nil && bytes.Compare(k[:8], maxB) <= 0; k, _ = c.Next() {
+			n++
+		}
+		return nil
+	})
+	return n, err
+}
+
+// Zremrangebyscore deletes the keys of a zset whose score is in
+// [min, max], removing both the zetKeyPrefix entry and its zetScorePrefix
+// mirror in a single transaction, and returns how many were removed.
+func (db *DB) Zremrangebyscore(name string, min, max uint64) (uint64, error) {
+	keyBucket := Bconcat([][]byte{zetKeyPrefix, S2b(name)})
+	scoreBucket := Bconcat([][]byte{zetScorePrefix, S2b(name)})
+	minB, maxB := I2b(min), I2b(max)
+
+	var removedKeys [][]byte
+	err := db.Update(func(tx BackendTx) error {
+		b1 := tx.Bucket(keyBucket)
+		if b1 == nil {
+			return errors.New(bucketNotFound)
+		}
+		b2 := tx.Bucket(scoreBucket)
+
+		c := b1.Cursor()
+		var matched [][]byte
+		for k, _ := c.Seek(minB); k != nil && bytes.Compare(k[:8], maxB) <= 0; k, _ = c.Next() {
+			matched = append(matched, append([]byte{}, k...))
+		}
+
+		for _, k := range matched {
+			key := k[8:]
+			if err := b1.Delete(k); err != nil {
+				return err
+			}
+			if b2 != nil {
+				if err := b2.Delete(key); err != nil {
+					return err
+				}
+			}
+			removedKeys = append(removedKeys, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	// Append one OpZdel per removed key, same as Zdel does, so a WAL
+	// follower doesn't drift from a range-delete done on the primary.
+	for _, key := range removedKeys {
+		if err := db.walAppend(Op{Opcode: OpZdel, Bucket: walBucketZset, Name: name, Key: key}); err != nil {
+			return 0, err
+		}
+	}
+	// Drop any leftover TTL entry for keys removed here, same as Zdel does.
+	for _, key := range removedKeys {
+		db.clearExpire(walBucketZset, name, key)
+	}
+	return uint64(len(removedKeys)), nil
+}
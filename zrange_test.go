@@ -0,0 +1,156 @@
+package youdb
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+// TestZremrangebyscoreAppendsWAL ensures a range-delete is recorded in the
+// WAL, not just applied to the backend, so a replica following ReplayFrom
+// doesn't silently drift from the primary.
+func TestZremrangebyscoreAppendsWAL(t *testing.T) {
+	base := t.TempDir()
+	db, err := OpenWithWAL(filepath.Join(base, "test.db"), WALOptions{Dir: filepath.Join(base, "wal")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	zsetAll(t, db, "z", map[string]uint64{"a": 1, "b": 2, "c": 3})
+
+	if _, err := db.Zremrangebyscore("z", 2, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	var ops []Op
+	if err := db.ReplayFrom(0, func(op Op) error {
+		ops = append(ops, op)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	var sawDel bool
+	for _, op := range ops {
+		if op.Opcode == OpZdel && string(op.Key) == "b" {
+			sawDel = true
+		}
+	}
+	if !sawDel {
+		t.Fatalf("expected an OpZdel for the removed key %q in the WAL, got %v", "b", ops)
+	}
+}
+
+func zsetAll(t *testing.T, db *DB, name string, kvs map[string]uint64) {
+	for k, v := range kvs {
+		if err := db.Zset(name, []byte(k), v); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestZrangebyscoreBoundsInclusive(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	zsetAll(t, db, "z", map[string]uint64{"a": 1, "b": 2, "c": 3, "d": 4})
+
+	r := db.Zrangebyscore("z", 2, 3, 0, 0)
+	if r.State != replyOK {
+		t.Fatalf("state: %s", r.State)
+	}
+	got := map[string]uint64{}
+	list := r.List()
+	for _, e := range list {
+		got[string(e.Key)] = e.Value.Uint64()
+	}
+	want := map[string]uint64{"b": 2, "c": 3}
+	if len(got) != len(want) || got["b"] != 2 || got["c"] != 3 {
+		t.Fatalf("expected boundary scores 2 and 3 both included, got %v", got)
+	}
+}
+
+func TestZrangebyscoreOffsetLimit(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	zsetAll(t, db, "z", map[string]uint64{"a": 1, "b": 2, "c": 3, "d": 4})
+
+	r := db.Zrangebyscore("z", scoreMin, scoreMax, 1, 2)
+	if r.State != replyOK {
+		t.Fatalf("state: %s", r.State)
+	}
+	if len(r.List()) != 2 {
+		t.Fatalf("expected limit to cap the result at 2, got %d: %v", len(r.List()), r.List())
+	}
+}
+
+func TestZrangebyscoreEmptyBucket(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	r := db.Zrangebyscore("missing", scoreMin, scoreMax, 0, 0)
+	if r.State != bucketNotFound {
+		t.Fatalf("expected bucket_not_found for an unknown zset, got %q", r.State)
+	}
+}
+
+func TestZcountBoundsInclusive(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	zsetAll(t, db, "z", map[string]uint64{"a": 1, "b": 2, "c": 3})
+
+	n, err := db.Zcount("z", 1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Fatalf("expected scores 1 and 2 to count (2), got %d", n)
+	}
+}
+
+func TestZremrangebyscoreRemovesBothMirrors(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	zsetAll(t, db, "z", map[string]uint64{"a": 1, "b": 2, "c": 3, "d": 4})
+
+	n, err := db.Zremrangebyscore("z", 2, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Fatalf("expected 2 entries removed, got %d", n)
+	}
+
+	if r := db.Zget("z", []byte("b")); r.State == replyOK {
+		t.Fatal("expected b's score mirror to be gone too")
+	}
+	if r := db.Zget("z", []byte("a")); r.State != replyOK {
+		t.Fatal("expected a (outside the removed range) to survive")
+	}
+
+	count, err := db.Zcount("z", scoreMin, scoreMax)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 {
+		t.Fatalf("expected 2 remaining entries (a, d), got %d", count)
+	}
+}